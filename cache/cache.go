@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFound is returned when a key or digest is not available in a store.
+var ErrNotFound = errors.New("not found in cache")
+
+// Artifact is a file produced by a task.
+type Artifact struct {
+	Path   string `json:"path"`
+	Digest string `json:"digest"`
+	Mode   uint32 `json:"mode"`
+}
+
+// Action is the result of a task; the list of artifacts it produced.
+type Action struct {
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Store is implemented by the backends where actions and blobs are saved.
+type Store interface {
+	// GetAction returns the action for the given key, or ErrNotFound.
+	GetAction(key string) (*Action, error)
+	// PutAction saves the action for the given key.
+	PutAction(key string, a *Action) error
+	// GetBlob returns a reader for the content of the given digest, or ErrNotFound.
+	GetBlob(digest string) (io.ReadCloser, error)
+	// PutBlob saves the content read from 'r', which must match the given digest.
+	PutBlob(digest string, r io.Reader) error
+}
+
+// Digest returns the hex encoded SHA-256 hash of the content read from 'r'.
+func Digest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkHash returns an error if 'k' is not a hex encoded SHA-256 hash. It prevents using
+// arbitrary strings as paths or URLs.
+func checkHash(k string) error {
+	if b, err := hex.DecodeString(k); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("invalid SHA-256 hash '%s'", k)
+	}
+	return nil
+}
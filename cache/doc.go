@@ -0,0 +1,25 @@
+/*
+Package cache provides a content-addressed store for the results of tasks (actions).
+
+The results of a task are identified by a key, which is the digest of the inputs of the task
+(i.e. the content of the sources, the commands and the environment). An 'Action' lists the
+artifacts produced by the task, each of them identified by the digest of its content. Artifacts
+are stored as blobs, so that a blob shared by several actions is saved only once.
+
+The layout of the stores is similar to the one used by bazel-remote:
+
+  - ac/<key>: action results, encoded as JSON.
+  - cas/<digest>: content of the artifacts.
+
+All the keys and digests are hex encoded SHA-256 hashes.
+
+Two backends are provided: 'Local' saves the entries in a directory, and 'HTTP' gets/puts them
+from/to a remote server through plain GET/PUT requests. 'WriteThrough' combines both of them,
+so that builds can be shared between developers and CI.
+
+References:
+  - Content-addressable storage: https://en.wikipedia.org/wiki/Content-addressable_storage
+  - Cache replacement policies (LRU): https://en.wikipedia.org/wiki/Cache_replacement_policies#LRU
+  - bazel-remote: https://github.com/buchgr/bazel-remote
+*/
+package cache
@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP is a Store in a remote server, accessed through plain GET and PUT requests. Actions
+// are located at '<URL>/ac/<key>' and blobs at '<URL>/cas/<digest>', which is compatible
+// with the HTTP layout of bazel-remote.
+type HTTP struct {
+	URL    string
+	Client *http.Client
+	// ReadOnly disables uploading actions and blobs. Put* methods succeed without doing
+	// anything.
+	ReadOnly bool
+}
+
+// Timeout is the time limit to connect to the server, and to receive the headers of the
+// responses, for the stores returned by NewHTTP; so that an unresponsive server does not block
+// the execution of the tasks. Transferring the content is not limited, since blobs might be
+// large.
+const Timeout = 30 * time.Second
+
+// NewHTTP returns an HTTP store for the server at 'url'.
+func NewHTTP(url string, readOnly bool) *HTTP {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = (&net.Dialer{Timeout: Timeout, KeepAlive: 30 * time.Second}).DialContext
+	t.TLSHandshakeTimeout = Timeout
+	t.ResponseHeaderTimeout = Timeout
+	return &HTTP{URL: strings.TrimSuffix(url, "/"), Client: &http.Client{Transport: t}, ReadOnly: readOnly}
+}
+
+func (h *HTTP) url(kind, k string) string {
+	return h.URL + "/" + kind + "/" + k
+}
+
+// get returns the body of the response to a GET request. The caller must close it.
+func (h *HTTP) get(kind, k string) (io.ReadCloser, error) {
+	if err := checkHash(k); err != nil {
+		return nil, err
+	}
+	r, err := h.Client.Get(h.url(kind, k))
+	if err != nil {
+		return nil, err
+	}
+	switch r.StatusCode {
+	case http.StatusOK:
+		return r.Body, nil
+	case http.StatusNotFound:
+		r.Body.Close()
+		return nil, ErrNotFound
+	}
+	r.Body.Close()
+	return nil, fmt.Errorf("GET %s: %s", h.url(kind, k), r.Status)
+}
+
+// put uploads the content read from 'b' through a PUT request.
+func (h *HTTP) put(kind, k string, b io.Reader) error {
+	if err := checkHash(k); err != nil {
+		return err
+	}
+	if h.ReadOnly {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodPut, h.url(kind, k), b)
+	if err != nil {
+		return err
+	}
+	r, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return fmt.Errorf("PUT %s: %s", h.url(kind, k), r.Status)
+	}
+	return nil
+}
+
+// GetAction implements Store.
+func (h *HTTP) GetAction(key string) (*Action, error) {
+	b, err := h.get("ac", key)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+	a := &Action{}
+	if err := json.NewDecoder(b).Decode(a); err != nil {
+		return nil, fmt.Errorf("action %s: %w", key, err)
+	}
+	return a, nil
+}
+
+// PutAction implements Store.
+func (h *HTTP) PutAction(key string, a *Action) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return h.put("ac", key, bytes.NewReader(b))
+}
+
+// GetBlob implements Store.
+func (h *HTTP) GetBlob(digest string) (io.ReadCloser, error) {
+	return h.get("cas", digest)
+}
+
+// PutBlob implements Store.
+func (h *HTTP) PutBlob(digest string, r io.Reader) error {
+	return h.put("cas", digest, r)
+}
+
+// WriteThrough combines a local and a remote store. Entries are read from the local store
+// first; on a miss, they are fetched from the remote and saved locally. Entries are written
+// to both of them.
+type WriteThrough struct {
+	Local  Store
+	Remote Store
+}
+
+// NewWriteThrough returns a WriteThrough store.
+func NewWriteThrough(local, remote Store) *WriteThrough {
+	return &WriteThrough{Local: local, Remote: remote}
+}
+
+// GetAction implements Store.
+func (w *WriteThrough) GetAction(key string) (*Action, error) {
+	a, err := w.Local.GetAction(key)
+	if !errors.Is(err, ErrNotFound) {
+		return a, err
+	}
+	if a, err = w.Remote.GetAction(key); err != nil {
+		return nil, err
+	}
+	return a, w.Local.PutAction(key, a)
+}
+
+// LookupAction returns the action for the given key in store 's', as GetAction, but without
+// saving it anywhere; i.e. actions found in the remote store of a WriteThrough are not written
+// to the local one. It is meant for checking the cache without side effects (e.g. dry runs).
+func LookupAction(s Store, key string) (*Action, error) {
+	w, ok := s.(*WriteThrough)
+	if !ok {
+		return s.GetAction(key)
+	}
+	a, err := LookupAction(w.Local, key)
+	if !errors.Is(err, ErrNotFound) {
+		return a, err
+	}
+	return LookupAction(w.Remote, key)
+}
+
+// PutAction implements Store.
+func (w *WriteThrough) PutAction(key string, a *Action) error {
+	if err := w.Local.PutAction(key, a); err != nil {
+		return err
+	}
+	return w.Remote.PutAction(key, a)
+}
+
+// GetBlob implements Store.
+func (w *WriteThrough) GetBlob(digest string) (io.ReadCloser, error) {
+	r, err := w.Local.GetBlob(digest)
+	if !errors.Is(err, ErrNotFound) {
+		return r, err
+	}
+	if r, err = w.Remote.GetBlob(digest); err != nil {
+		return nil, err
+	}
+	err = w.Local.PutBlob(digest, r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	return w.Local.GetBlob(digest)
+}
+
+// PutBlob implements Store. The content is read from the local store for the upload, so
+// that 'r' is consumed once.
+func (w *WriteThrough) PutBlob(digest string, r io.Reader) error {
+	if err := w.Local.PutBlob(digest, r); err != nil {
+		return err
+	}
+	l, err := w.Local.GetBlob(digest)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return w.Remote.PutBlob(digest, l)
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newTestServer returns an in-memory server which implements the GET/PUT protocol.
+func newTestServer(t *testing.T) (*httptest.Server, map[string][]byte) {
+	var mu sync.Mutex
+	m := make(map[string][]byte)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			b, ok := m[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write(b)
+		case http.MethodPut:
+			b, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			m[r.URL.Path] = b
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s, m
+}
+
+func TestHTTP(t *testing.T) {
+	s, m := newTestServer(t)
+	h := NewHTTP(s.URL+"/", false)
+
+	d := digestOf(t, "hello")
+	if _, err := h.GetBlob(d); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := h.PutBlob(d, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["/cas/"+d]; !ok {
+		t.Fatalf("blob not found in server at /cas/%s", d)
+	}
+	r, err := h.GetBlob(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("unexpected blob %q (%v)", b, err)
+	}
+
+	k := digestOf(t, "key")
+	if err := h.PutAction(k, &Action{Artifacts: []Artifact{{Path: "a.o", Digest: d}}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := h.GetAction(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Artifacts) != 1 || a.Artifacts[0].Path != "a.o" {
+		t.Errorf("unexpected action %+v", a)
+	}
+}
+
+func TestHTTPReadOnly(t *testing.T) {
+	s, m := newTestServer(t)
+	h := NewHTTP(s.URL, true)
+	if err := h.PutBlob(digestOf(t, "hello"), strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 0 {
+		t.Errorf("expected no uploads in read-only mode, got %d", len(m))
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	s, m := newTestServer(t)
+	remote := NewHTTP(s.URL, false)
+	local := NewLocal(t.TempDir(), 0)
+	w := NewWriteThrough(local, remote)
+
+	d := digestOf(t, "hello")
+	if err := w.PutBlob(d, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if string(m["/cas/"+d]) != "hello" {
+		t.Fatalf("blob not uploaded to server")
+	}
+
+	// An entry which is only available remotely is fetched and saved locally
+	k := digestOf(t, "key")
+	if err := remote.PutAction(k, &Action{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupAction(w, k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.GetAction(k); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected action not to be saved locally by LookupAction, got %v", err)
+	}
+	if _, err := w.GetAction(k); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.GetAction(k); err != nil {
+		t.Errorf("expected action to be saved locally, got %v", err)
+	}
+}
@@ -0,0 +1,229 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Local is a Store in a directory of the local filesystem. The modification time of the
+// entries is updated when they are read, so that the least recently used ones are evicted
+// first when the size of the store exceeds MaxSize.
+type Local struct {
+	Dir string
+	// MaxSize is the maximum size of the store, in bytes. If lower than one, no limit is applied.
+	MaxSize int64
+}
+
+// Stats is the usage of a Local store.
+type Stats struct {
+	Actions int
+	Blobs   int
+	Size    int64
+	MaxSize int64
+}
+
+// NewLocal returns a Local store in directory 'dir', with a size limit of 'size' bytes.
+func NewLocal(dir string, size int64) *Local {
+	return &Local{Dir: dir, MaxSize: size}
+}
+
+func (l *Local) path(kind, k string) string {
+	return filepath.Join(l.Dir, kind, k)
+}
+
+// touch updates the modification time of an entry, to keep track of the last usage.
+func touch(p string) {
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+}
+
+// GetAction implements Store.
+func (l *Local) GetAction(key string) (*Action, error) {
+	if err := checkHash(key); err != nil {
+		return nil, err
+	}
+	p := l.path("ac", key)
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	a := &Action{}
+	if err := json.Unmarshal(b, a); err != nil {
+		return nil, fmt.Errorf("action %s: %w", key, err)
+	}
+	touch(p)
+	return a, nil
+}
+
+// PutAction implements Store.
+func (l *Local) PutAction(key string, a *Action) error {
+	if err := checkHash(key); err != nil {
+		return err
+	}
+	b, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return l.write(l.path("ac", key), func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// GetBlob implements Store.
+func (l *Local) GetBlob(digest string) (io.ReadCloser, error) {
+	if err := checkHash(digest); err != nil {
+		return nil, err
+	}
+	p := l.path("cas", digest)
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	touch(p)
+	return f, nil
+}
+
+// PutBlob implements Store.
+func (l *Local) PutBlob(digest string, r io.Reader) error {
+	if err := checkHash(digest); err != nil {
+		return err
+	}
+	p := l.path("cas", digest)
+	if _, err := os.Stat(p); err == nil {
+		touch(p)
+		return nil
+	}
+	return l.write(p, func(w io.Writer) error {
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, h), r); err != nil {
+			return err
+		}
+		if d := hex.EncodeToString(h.Sum(nil)); d != digest {
+			return fmt.Errorf("digest mismatch: expected %s, got %s", digest, d)
+		}
+		return nil
+	})
+}
+
+// write creates file 'p' atomically, by writing to a temporary file first.
+func (l *Local) write(p string, fn func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// entry is a file of the store.
+type entry struct {
+	path  string
+	kind  string
+	size  int64
+	mtime time.Time
+}
+
+// entries returns all the files of the store, sorted from least to most recently used.
+func (l *Local) entries() ([]entry, error) {
+	o := make([]entry, 0)
+	for _, kind := range []string{"ac", "cas"} {
+		ds, err := os.ReadDir(filepath.Join(l.Dir, kind))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		for _, d := range ds {
+			i, err := d.Info()
+			if err != nil || !i.Mode().IsRegular() {
+				continue
+			}
+			o = append(o, entry{filepath.Join(l.Dir, kind, d.Name()), kind, i.Size(), i.ModTime()})
+		}
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].mtime.Before(o[j].mtime) })
+	return o, nil
+}
+
+// Stats returns the number of actions and blobs in the store, and the total size.
+func (l *Local) Stats() (Stats, error) {
+	s := Stats{MaxSize: l.MaxSize}
+	es, err := l.entries()
+	if err != nil {
+		return s, err
+	}
+	for _, e := range es {
+		if e.kind == "ac" {
+			s.Actions++
+		} else {
+			s.Blobs++
+		}
+		s.Size += e.size
+	}
+	return s, nil
+}
+
+// Prune evicts the least recently used entries until the size of the store is not larger
+// than MaxSize. It returns the number of evicted entries and the size that was freed.
+func (l *Local) Prune() (int, int64, error) {
+	if l.MaxSize < 1 {
+		return 0, 0, nil
+	}
+	es, err := l.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, e := range es {
+		size += e.size
+	}
+	n, freed := 0, int64(0)
+	for _, e := range es {
+		if size-freed <= l.MaxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			return n, freed, err
+		}
+		n++
+		freed += e.size
+	}
+	return n, freed, nil
+}
+
+// Clear removes all the entries of the store.
+func (l *Local) Clear() error {
+	for _, kind := range []string{"ac", "cas"} {
+		if err := os.RemoveAll(filepath.Join(l.Dir, kind)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
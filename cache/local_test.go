@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func digestOf(t *testing.T, s string) string {
+	d, err := Digest(strings.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestLocal(t *testing.T) {
+	l := NewLocal(t.TempDir(), 0)
+
+	d := digestOf(t, "hello")
+	if _, err := l.GetBlob(d); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := l.PutBlob(d, strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.PutBlob(digestOf(t, "other"), strings.NewReader("hello")); err == nil {
+		t.Error("expected digest mismatch")
+	}
+	r, err := l.GetBlob(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("unexpected blob %q (%v)", b, err)
+	}
+
+	k := digestOf(t, "key")
+	if err := l.PutAction(k, &Action{Artifacts: []Artifact{{Path: "a.o", Digest: d, Mode: 0644}}}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := l.GetAction(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Artifacts) != 1 || a.Artifacts[0].Digest != d {
+		t.Errorf("unexpected action %+v", a)
+	}
+
+	if _, err := l.GetAction("../escape"); err == nil {
+		t.Error("expected invalid key")
+	}
+
+	s, err := l.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Actions != 1 || s.Blobs != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+
+	if err := l.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := l.Stats(); s.Actions != 0 || s.Blobs != 0 {
+		t.Errorf("unexpected stats after clear %+v", s)
+	}
+}
+
+func TestLocalPrune(t *testing.T) {
+	l := NewLocal(t.TempDir(), 10)
+	ds := make([]string, 0)
+	for i, x := range []string{"aaaa", "bbbb", "cccc"} {
+		d := digestOf(t, x)
+		if err := l.PutBlob(d, strings.NewReader(x)); err != nil {
+			t.Fatal(err)
+		}
+		m := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(l.path("cas", d), m, m); err != nil {
+			t.Fatal(err)
+		}
+		ds = append(ds, d)
+	}
+	// Reading the oldest blob makes it the most recently used one
+	r, err := l.GetBlob(ds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	n, s, err := l.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || s != 4 {
+		t.Errorf("expected 1 entry (4 bytes) evicted, got %d (%d)", n, s)
+	}
+	if _, err := l.GetBlob(ds[1]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected least recently used blob to be evicted, got %v", err)
+	}
+}
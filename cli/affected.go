@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dbhi/run/lib"
+	v "github.com/spf13/viper"
+	"github.com/umarcor/cobra"
+)
+
+// affectedCmd represents the affected command
+var affectedCmd = &cobra.Command{
+	Use:   "affected",
+	Short: "List the tasks affected by the changes since a git revision",
+	Long: `List the files changed in the local git repository since the given revision,
+the sources (nodes of type SRC) whose 'data' patterns match them, and the tasks
+and leafs which depend on those sources. Use 'run exec --since REV' to execute
+the affected tasks.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		a := affected(v.GetString("since"))
+		for _, x := range []struct {
+			name string
+			ids  []string
+		}{
+			{"files", a.Files},
+			{"sources", a.Sources},
+			{"jobs", a.Jobs},
+			{"leafs", a.Leafs},
+		} {
+			fmt.Printf("[%s]\n", x.name)
+			for _, i := range x.ids {
+				fmt.Println("  ", i)
+			}
+		}
+	},
+}
+
+// affected returns the nodes of the graph given through flag 'graph' (see readGraph) which
+// are affected by the files changed in the git repository since revision 'since'.
+func affected(since string) *lib.Affected {
+	fs, err := lib.ChangedFiles("", since)
+	checkErr(err)
+	a, err := lib.AffectedBy(readGraph(), loadConfig(), fs)
+	checkErr(err)
+	return a
+}
+
+func init() {
+	rootCmd.AddCommand(affectedCmd)
+	f := affectedCmd.Flags()
+	flag, _ := FlagFuncs(f)
+	flag("since", "HEAD", "git revision to compare the working tree with")
+	checkErr(v.BindPFlag("since", f.Lookup("since")))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dbhi/run/cache"
+	v "github.com/spf13/viper"
+	"github.com/umarcor/cobra"
+)
+
+// localCache returns the local cache store defined through flags 'cache-dir' and 'cache-size'
+func localCache() *cache.Local {
+	return cache.NewLocal(v.GetString("cache-dir"), int64(v.GetInt("cache-size"))<<20)
+}
+
+// cacheStore returns the local cache, which is combined with the remote cache defined
+// through flag 'remote-cache', if any
+func cacheStore(l *cache.Local) cache.Store {
+	if u := v.GetString("remote-cache"); u != "" {
+		return cache.NewWriteThrough(l, cache.NewHTTP(u, v.GetBool("remote-cache-read-only")))
+	}
+	return l
+}
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cache",
+	Long:  `Manage the local cache of artifacts, where the results of the tasks are saved.`,
+}
+
+// cacheStatsCmd represents the cache stats command
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show usage of the cache",
+	Long:  `Show the number of actions and blobs in the local cache, and the total size.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		l := localCache()
+		s, err := l.Stats()
+		checkErr(err)
+		fmt.Printf("directory: %s\n", l.Dir)
+		fmt.Printf("actions:   %d\n", s.Actions)
+		fmt.Printf("blobs:     %d\n", s.Blobs)
+		fmt.Printf("size:      %.2f MiB / %.2f MiB\n", float64(s.Size)/(1<<20), float64(s.MaxSize)/(1<<20))
+	},
+}
+
+// cachePruneCmd represents the cache prune command
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Evict least recently used entries",
+	Long:  `Evict the least recently used entries of the local cache, until the size is within the limit.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		n, s, err := localCache().Prune()
+		checkErr(err)
+		fmt.Printf("evicted %d entries (%.2f MiB)\n", n, float64(s)/(1<<20))
+	},
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all the entries",
+	Long:  `Remove all the entries of the local cache.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		checkErr(localCache().Clear())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+}
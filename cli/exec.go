@@ -1,11 +1,18 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/dbhi/run/dep"
 	"github.com/dbhi/run/lib"
+	au "github.com/logrusorgru/aurora"
+	v "github.com/spf13/viper"
 	"github.com/umarcor/cobra"
 )
 
@@ -13,31 +20,178 @@ import (
 var execCmd = &cobra.Command{
 	Use:   "exec",
 	Short: "Exec list of tasks",
-	Long:  `Exec list of tasks for the given nodes.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `Exec list of tasks for the given nodes, in topological order.
+With '--since REV', the tasks affected by the changes since the given git
+revision are executed too (see 'run affected').`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if s, _ := cmd.Flags().GetString("since"); s != "" {
+			return nil
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		cmdOut := new(bytes.Buffer)
-		cmdErr := new(bytes.Buffer)
+		cfg := loadConfig()
+		n, err := cmd.Flags().GetInt("jobs")
+		checkErr(err)
+		if s, _ := cmd.Flags().GetString("since"); s != "" {
+			a := affected(s)
+			if len(a.Sources) == 0 && len(args) == 0 {
+				fmt.Printf("no task is affected by the changes since '%s'\n", s)
+				return
+			}
+			if len(a.Sources) != 0 {
+				args = append(args, a.Selection())
+			}
+		}
+		m, err := lib.ParseOutput(v.GetString("output-mode"))
+		checkErr(err)
+		g, err := time.ParseDuration(v.GetString("grace-period"))
+		checkErr(err)
+		o := lib.Options{
+			Jobs:        n,
+			Verbose:     true,
+			Output:      m,
+			Color:       v.GetBool("color"),
+			Force:       v.GetBool("force"),
+			KeepGoing:   v.GetBool("keep-going") || !v.GetBool("fail-fast"),
+			DryRun:      v.GetBool("dry-run"),
+			StateDir:    v.GetString("state-dir"),
+			Resume:      v.GetBool("resume"),
+			GracePeriod: g,
+		}
+		ctx, stop := lib.NotifyContext(context.Background())
+		defer stop()
+		if v.GetBool("no-cache") {
+			checkErr(execTargets(ctx, cfg, args, o))
+			return
+		}
+		l := localCache()
+		o.Cache = cacheStore(l)
+		err = execTargets(ctx, cfg, args, o)
+		// The cache is pruned even if the execution failed, because the artifacts of the
+		// tasks which succeeded were saved
+		_, _, perr := l.Prune()
+		checkErr(perr)
+		checkErr(err)
+	},
+}
 
-		checkErr(lib.ExecCmd("", args[0], args[1:], nil, cmdOut, cmdErr, true))
+// execTargets executes the subgraph for each of the given nodes, and it prints the results.
+// Execution stops at the first failure, unless 'KeepGoing' is set, or when 'ctx' is done. With
+// 'KeepGoing', the errors of all the targets are reported together at the end.
+func execTargets(ctx context.Context, cfg *lib.Config, args []string, o lib.Options) error {
+	l, r := subGraphs()
+	errs := make([]string, 0)
+	for _, a := range args {
+		if ctx.Err() != nil {
+			break
+		}
+		err := execTarget(ctx, cfg, l, r, a, o)
+		if err == nil {
+			continue
+		}
+		if !o.KeepGoing {
+			return err
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", a, err))
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%d target(s) failed:\n  %s", len(errs), strings.Join(errs, "\n  "))
+	}
+	return ctx.Err()
+}
 
-		b, err := io.ReadAll(cmdOut)
-		checkErr(err)
-		fmt.Println("cmdOut:\n", string(b))
+// execTarget executes the subgraph for node 'a' (see lib.Select), and it prints the results.
+func execTarget(ctx context.Context, cfg *lib.Config, l, r map[string]*dep.DependencyGraph, a string, o lib.Options) error {
+	s, n, err := lib.Select(l, r, a)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%s]\n", n)
+	rs, err := lib.Exec(ctx, s, n, cfg, o)
+	if o.DryRun {
+		dir := o.Dir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		printPlan(rs, dir)
+	} else {
+		printResults(rs)
+	}
+	return err
+}
 
-		b, err = io.ReadAll(cmdErr)
-		checkErr(err)
-		fmt.Println("cmdErr:\n", string(b))
+// printPlan prints the status, working directory, environment and commands of each result,
+// as computed in dry-run mode.
+func printPlan(rs []*lib.Result, dir string) {
+	for _, r := range rs {
+		fmt.Printf("   %-10s %-10s [%s]\n", r.Task.DOTID, r.Status, r.Reason)
+		if r.Status != lib.Planned {
+			continue
+		}
+		fmt.Printf("      dir: %s\n", dir)
+		ks := make([]string, 0, len(r.Task.Env))
+		for k := range r.Task.Env {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+		for _, k := range ks {
+			fmt.Printf("      env: %s=%s\n", k, r.Task.Env[k])
+		}
+		for _, l := range r.Task.Script() {
+			fmt.Printf("      $ %s\n", l)
+		}
+	}
+}
 
-	},
+// printResults prints the status, duration, exit code and reason of each result, along with
+// its attempts and warnings (to stderr), followed by a summary of the number of tasks in each status.
+func printResults(rs []*lib.Result) {
+	for _, r := range rs {
+		fmt.Printf("   %-10s %-10s %10s", r.Task.DOTID, r.Status, r.Duration.Round(time.Millisecond))
+		if r.Status == lib.Failed {
+			fmt.Printf(" (exit code %d", r.ExitCode)
+			if r.Task.AllowFailure {
+				fmt.Print(", allowed")
+			}
+			fmt.Print(")")
+		}
+		if r.Reason != "" {
+			fmt.Printf(" [%s]", r.Reason)
+		}
+		fmt.Println()
+		if len(r.Attempts) > 1 {
+			for i, a := range r.Attempts {
+				fmt.Printf("      attempt %d: exit code %d, %s\n", i+1, a.ExitCode, a.Duration.Round(time.Millisecond))
+			}
+		}
+		for _, w := range r.Warnings {
+			fmt.Fprintln(os.Stderr, au.Yellow("      warning: "+w))
+		}
+	}
+	fmt.Printf("   %s\n", lib.Summary(rs))
 }
 
 func init() {
 	rootCmd.AddCommand(execCmd)
-	/*
-		f := execCmd.PersistentFlags()
-		// Bind the full flag set to the configuration
-		err := v.BindPFlags(f)
-		checkErr(err)
-	*/
+	f := execCmd.Flags()
+	flag, flagP := FlagFuncs(f)
+	// Not bound to viper, because key 'jobs' of the configuration holds the context of the tasks
+	f.IntP("jobs", "j", runtime.NumCPU(), "maximum number of tasks to execute concurrently")
+	// Not bound to viper, because key 'since' is bound to the flag of the affected command
+	f.String("since", "", "execute the tasks affected by the changes since the given git revision")
+	flag("force", false, "execute all the tasks, even if they are up to date")
+	flag("no-cache", false, "do not save or restore artifacts through the cache")
+	flagP("dry-run", "n", false, "print the commands that would be executed, without executing them")
+	flagP("keep-going", "k", false, "keep executing the tasks which do not depend on failed ones")
+	flag("fail-fast", true, "do not start new tasks after a failure (default)")
+	execCmd.MarkFlagsMutuallyExclusive("keep-going", "fail-fast")
+	flag("output-mode", "interleaved", "how to show the output of concurrent tasks: 'interleaved', 'group' or 'prefixed'")
+	flag("color", false, "color the prefixes in 'prefixed' output mode")
+	flag("grace-period", lib.DefaultGracePeriod.String(), "time that tasks are given to exit after being signalled, before being killed")
+	flag("state-dir", ".run/state", "directory where the state of each run is saved")
+	flag("resume", false, "skip the tasks which succeeded in the last run, unless their inputs changed")
+	for _, k := range []string{"force", "no-cache", "dry-run", "keep-going", "fail-fast", "state-dir", "resume", "output-mode", "color", "grace-period"} {
+		checkErr(v.BindPFlag(k, f.Lookup(k)))
+	}
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"github.com/dbhi/run/lib"
+	au "github.com/logrusorgru/aurora"
+	v "github.com/spf13/viper"
+	"github.com/umarcor/cobra"
+)
+
+// graphCmd represents the graph command
+var graphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Analyse the graph",
+	Long:  `Analyse and transform the dependency graph.`,
+}
+
+// graphCheckCmd represents the graph check command
+var graphCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check that the graph is acyclic",
+	Long: `Check that the graph is a directed acyclic graph (DAG). For each set of nodes
+with circular dependencies, the edges which close the cycles are shown.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cs := readGraph().Cycles()
+		if len(cs) == 0 {
+			fmt.Println("no cycles found")
+			return
+		}
+		for i, c := range cs {
+			fmt.Printf("[cycle %d] %d nodes\n", i+1, len(c.Nodes))
+			for _, b := range c.Back {
+				fmt.Println("  ", b)
+			}
+		}
+		checkErr(&lib.CycleError{Cycles: cs})
+	},
+}
+
+// graphReduceCmd represents the graph reduce command
+var graphReduceCmd = &cobra.Command{
+	Use:   "reduce",
+	Short: "Remove redundant edges",
+	Long: `Compute the transitive reduction of the graph; i.e. remove the edges between
+nodes which are connected through a longer path. The attributes of nodes and edges
+are kept. The result is written to the file given through flag 'output', or to
+stdout.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		d := readGraph()
+		r, err := d.Reduce()
+		if err != nil {
+			checkErr(&lib.CycleError{Cycles: d.Cycles()})
+		}
+		writeGraph(r)
+	},
+}
+
+// graphMergeCmd represents the graph merge command
+var graphMergeCmd = &cobra.Command{
+	Use:   "merge",
+	Short: "Merge several graphs",
+	Long: `Merge the graphs given through flag 'graph' (e.g. '-g hw.dot -g sw.dot').
+Nodes are unified by DOTID and duplicated edges are removed. When the same
+attribute of a node or an edge has different values, the first one is kept and
+the conflict is shown. The result is written to the file given through flag
+'output', or to stdout.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		writeGraph(readGraph())
+	},
+}
+
+// graphDiffCmd represents the graph diff command
+var graphDiffCmd = &cobra.Command{
+	Use:   "diff OLD NEW",
+	Short: "Compare two graphs",
+	Long: `Compare two DOT files, given as paths or as 'REV:PATH' to read a file from a
+revision of the git repository (e.g. 'HEAD~1:graph.dot'). Added and removed nodes
+and edges, changes of attributes, and jobs whose subgraph (the nodes they depend
+on) or stage (see 'list --stages') changed are reported. Use '--format' to print
+them as 'text' or 'json', or to write a 'dot' graph with the changes colored. JSON
+and DOT are written to the file given through flag 'output', or to stdout.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		a, b := readGraphAt(args[0]), readGraphAt(args[1])
+		d, err := lib.DiffGraphs(a, b)
+		checkErr(err)
+		switch f := v.GetString("format"); f {
+		case "text":
+			printDiff(d)
+		case "json":
+			var b bytes.Buffer
+			e := json.NewEncoder(&b)
+			e.SetEscapeHTML(false)
+			e.SetIndent("", "  ")
+			checkErr(e.Encode(d))
+			writeOutput(bytes.TrimSpace(b.Bytes()))
+		case "dot":
+			writeGraph(lib.DiffGraph(a, b, d))
+		default:
+			checkErr(fmt.Errorf("unknown format '%s' (use 'text', 'json' or 'dot')", f))
+		}
+	},
+}
+
+// readGraphAt reads DOT file 'f', which can be given as 'REV:PATH' to read it from a revision
+// of the git repository, unless a file named 'f' exists.
+func readGraphAt(f string) *dep.DependencyGraph {
+	if _, err := os.Stat(f); err != nil {
+		if i := strings.Index(f, ":"); i > 0 {
+			d, err := lib.ReadGraphFromRevision("", f[:i], f[i+1:])
+			checkErr(err)
+			return d
+		}
+	}
+	d, err := lib.ReadGraphFromFile(f)
+	checkErr(err)
+	return d
+}
+
+// printDiff prints the changes between two graphs, grouped by kind.
+func printDiff(d *lib.Diff) {
+	if d.Cyclic {
+		fmt.Fprintln(os.Stderr, au.Yellow("warning: the stages of the jobs are not compared, because a graph has cycles"))
+	}
+	if d.Empty() {
+		fmt.Println("no changes")
+		return
+	}
+	for _, x := range []struct {
+		name  string
+		items []string
+		mark  string
+	}{
+		{"node", d.RemovedNodes, "-"},
+		{"node", d.AddedNodes, "+"},
+		{"edge", d.RemovedEdges, "-"},
+		{"edge", d.AddedEdges, "+"},
+	} {
+		for _, i := range x.items {
+			fmt.Printf("   %s %s %s\n", x.mark, x.name, i)
+		}
+	}
+	for _, c := range d.Changed {
+		for _, a := range c.Attrs {
+			fmt.Printf("   ~ %s: %s\n", c.Element, a)
+		}
+	}
+	for _, j := range d.Jobs {
+		fmt.Printf("   ! job %s\n", j)
+	}
+}
+
+// writeGraph writes a graph to the file given through flag 'output', or to stdout if the
+// flag is empty or 'stdout'.
+func writeGraph(d *dep.DependencyGraph) {
+	b := dot.Marshal(d)
+	if b == nil {
+		checkErr(fmt.Errorf("Marshal failed"))
+	}
+	writeOutput(b)
+}
+
+// writeOutput writes 'b' to the file given through flag 'output', or to stdout if the flag
+// is empty or 'stdout'.
+func writeOutput(b []byte) {
+	switch o := v.GetString("output"); o {
+	case "", "stdout":
+		fmt.Println(string(b))
+	default:
+		checkErr(os.WriteFile(o, b, 0600))
+		fmt.Printf("Writing to '%s'\n", o)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(graphCmd)
+	graphCmd.AddCommand(graphCheckCmd)
+	graphCmd.AddCommand(graphReduceCmd)
+	graphCmd.AddCommand(graphMergeCmd)
+	graphCmd.AddCommand(graphDiffCmd)
+	f := graphDiffCmd.Flags()
+	flag, _ := FlagFuncs(f)
+	flag("format", "text", "output format: 'text', 'json' or 'dot'")
+	checkErr(v.BindPFlag("format", f.Lookup("format")))
+}
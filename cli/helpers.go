@@ -4,8 +4,14 @@ import (
 	"github.com/spf13/pflag"
 	v "github.com/spf13/viper"
 
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/lib"
 
 	au "github.com/logrusorgru/aurora"
 )
@@ -19,6 +25,8 @@ func FlagFuncs(f *pflag.FlagSet) (flag func(k string, i interface{}, u string),
 			f.Int(k, y, u)
 		case string:
 			f.String(k, y, u)
+		case []string:
+			f.StringSlice(k, y, u)
 		}
 		v.SetDefault(k, i)
 	}
@@ -30,12 +38,75 @@ func FlagFuncs(f *pflag.FlagSet) (flag func(k string, i interface{}, u string),
 			f.IntP(k, p, y, u)
 		case string:
 			f.StringP(k, p, y, u)
+		case []string:
+			f.StringSliceP(k, p, y, u)
 		}
 		v.SetDefault(k, i)
 	}
 	return
 }
 
+// loadConfig returns the configuration of the jobs. JSON files are read with lib.ReadConfigFile,
+// because viper lowers the case of all the keys (e.g. the names of environment variables).
+// Other formats are read through viper, and an error is reported if any job sets field 'env'.
+func loadConfig() *lib.Config {
+	if f := v.ConfigFileUsed(); strings.EqualFold(filepath.Ext(f), ".json") {
+		c, err := lib.ReadConfigFile(f)
+		checkErr(err)
+		return c
+	}
+	c := &lib.Config{}
+	checkErr(v.UnmarshalKey("vars", &c.Vars))
+	checkErr(v.UnmarshalKey("jobs", &c.Jobs))
+	checkErr(v.UnmarshalKey("edges", &c.Edges))
+	// Viper lowercases the keys, which would change the names of the environment variables
+	for k, j := range c.Jobs {
+		if len(j.Env) != 0 {
+			checkErr(fmt.Errorf("job '%s': field 'env' is only supported in JSON configuration files, because the names of the variables would be lowercased", k))
+		}
+	}
+	return c
+}
+
+// readGraph reads the graphs given through flag 'graph' (or 'graph.dot' if it exists), along
+// with the edges of the configuration. If several graphs are given, they are merged and the
+// conflicts are shown (see lib.ReadGraphsFromFiles). If no graph is given, lib.ExampleGraph
+// is used.
+func readGraph() *dep.DependencyGraph {
+	fs := v.GetStringSlice("graph")
+	if len(fs) == 0 {
+		if _, err := os.Stat("graph.dot"); err == nil {
+			fs = []string{"graph.dot"}
+		}
+	}
+	d, cs, err := lib.ReadGraphsFromFiles(fs, loadConfig().Edges)
+	if errors.Is(err, lib.ErrNoGraph) {
+		fmt.Println("Empty file path! Please provide a DOT file")
+		fmt.Println("Using the following content as an example:")
+		fmt.Println(lib.ExampleGraph)
+		d, err = lib.ParseGraph([]byte(lib.ExampleGraph))
+	}
+	checkErr(err)
+	for _, c := range cs {
+		fmt.Fprintln(os.Stderr, au.Yellow("conflicting attribute: "+c.String()))
+	}
+	return d
+}
+
+// subGraphs returns the subgraphs for each of the leafs and roots of the graph given through
+// flag 'graph' (see readGraph).
+func subGraphs() (map[string]*dep.DependencyGraph, map[string]*dep.DependencyGraph) {
+	d := readGraph()
+	l, r := lib.InduceSubGraphs(d)
+	if len(l) == 0 || len(r) == 0 {
+		if cs := d.Cycles(); len(cs) != 0 {
+			checkErr(&lib.CycleError{Cycles: cs})
+		}
+		checkErr(errors.New("Something went wrong. Empty subgraph map!"))
+	}
+	return l, r
+}
+
 func checkErr(err error) {
 	if err != nil {
 		fmt.Println(au.Red(err))
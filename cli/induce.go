@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/dbhi/run/lib"
 	v "github.com/spf13/viper"
 	"github.com/umarcor/cobra"
@@ -13,7 +15,12 @@ var induceCmd = &cobra.Command{
 	Long:  `Induce subgraph for the given nodes.`,
 	//Args:  cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		lib.Induce(v.GetString("graph"), v.GetString("output"), args)
+		l, r := subGraphs()
+		fs, err := lib.Induce(l, r, v.GetString("output"), args)
+		for _, f := range fs {
+			fmt.Printf("Writing graph to '%s'\n", f)
+		}
+		checkErr(err)
 	},
 }
 
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/dbhi/run/lib"
 	v "github.com/spf13/viper"
 	"github.com/umarcor/cobra"
@@ -10,19 +13,42 @@ import (
 var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List the topological order",
-	Long:  `List the topological order of the subgraph(s) for the given node(s).`,
+	Long: `List the topological order of the subgraph(s) for the given node(s).
+With '--stages', the tasks are grouped in stages, where all the tasks in a stage
+can be executed at the same time. Use '--width' to limit the number of tasks per
+stage.`,
 	//Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		lib.List(v.GetString("graph"), args)
+		l, r := subGraphs()
+		if v.GetBool("stages") {
+			ls, err := lib.ListStages(l, r, args, v.GetInt("width"))
+			for _, x := range ls {
+				fmt.Printf("[%s]\n", x.Name)
+				for i, s := range x.Stages {
+					fmt.Printf("   %d: %s\n", i+1, strings.Join(s, " "))
+				}
+			}
+			checkErr(err)
+			return
+		}
+		ls, err := lib.List(l, r, args)
+		for _, x := range ls {
+			fmt.Printf("[%s]\n", x.Name)
+			for _, i := range x.Tasks {
+				fmt.Println("  ", i)
+			}
+		}
+		checkErr(err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
-	/*
-		f := listCmd.PersistentFlags()
-		// Bind the full flag set to the configuration
-		err := v.BindPFlags(f)
-		checkErr(err)
-	*/
+	f := listCmd.Flags()
+	flag, _ := FlagFuncs(f)
+	flag("stages", false, "group the tasks in stages which can be executed at the same time")
+	flag("width", 0, "maximum number of tasks per stage (unlimited if zero)")
+	for _, k := range []string{"stages", "width"} {
+		checkErr(v.BindPFlag(k, f.Lookup(k)))
+	}
 }
@@ -28,13 +28,24 @@ var rootCmd = &cobra.Command{
 	Version: "v0.0.0",
 	Short:   au.Sprintf(au.Cyan("[RUN] a task execution automation package")),
 	Long: `A task execution automation package for complex dependency graphs.
-Currently only DOT files are supported as input. To retrieve the ordered list of
-tasks for a given target, use the following syntax 'leaf[|task]'. The optional
-argument 'task' allows to filter the list to include only a subset of the tasks
-in the subgraphs corresponding to the leaf. It can be either of:
+Currently only DOT files are supported as input. The targets of 'list', 'induce'
+and 'exec' are selection expressions, which combine sets of nodes:
+
+  expr     = diff { ',' diff }        union
+  diff     = inter { '-' inter }      exclusion
+  inter    = unary { '&' unary }      intersection
+  unary    = '(' expr ')' | selector
+  selector = KEY '=' VALUE | NODE[|TASK]
+
+'NODE' is the subgraph of a node. The optional 'TASK' filters the tasks in it:
 - '>DOTID' tasks that allow build DOTID.
 - 'DOTID>' tasks that depend on DOTID.
 - '>DOTID>' tasks that allow to build DOTID and those that depend on it.
+NODE and TASK can be shell globs ('build*') or regular expressions ('re:^obj');
+prefix 'id:' selects a DOTID with glob characters literally ('id:a[1]').
+'KEY=VALUE' matches DOT attributes (e.g. 'type=JOB'), the DOTID ('id=...') or
+the namespace ('ns=...'). Exclusions need a space before '-': 'bin - getA'.
+See the README for details.
 `,
 }
 
@@ -45,13 +56,17 @@ func init() {
 
 	f := rootCmd.PersistentFlags()
 	// Helper functions to set cobra and viper at once
-	_, flagP := FlagFuncs(f)
+	flag, flagP := FlagFuncs(f)
 
 	// Define flags and defaults
 	f.StringVarP(&cfgFile, "config", "c", "", "config file (defaults are './.run[ext]', '$HOME/.run[ext]' or '/etc/run/.run[ext]')")
 	flagP("log", "l", "stdout", "errors logger; can use 'stdout', 'stderr' or file")
-	flagP("graph", "g", "", "input DOT graph file")
+	flagP("graph", "g", []string{}, "input DOT graph file(s), merged by DOTID if several are given")
 	flagP("output", "o", "", "output ('stdout' or path)")
+	flag("cache-dir", ".run/cache", "directory of the local cache of artifacts")
+	flag("cache-size", 1024, "maximum size of the local cache of artifacts, in MiB")
+	flag("remote-cache", "", "URL of a remote HTTP cache of artifacts")
+	flag("remote-cache-read-only", false, "do not upload artifacts to the remote cache")
 
 	// Bind the full flag set to the configuration
 	err := v.BindPFlags(f)
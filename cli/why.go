@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dbhi/run/lib"
+	v "github.com/spf13/viper"
+	"github.com/umarcor/cobra"
+)
+
+// whyCmd represents the why command
+var whyCmd = &cobra.Command{
+	Use:   "why FROM TO | why --reverse NODE",
+	Short: "Explain how one node depends on another",
+	Long: `Print the paths from FROM to TO (i.e. how TO depends on FROM), along with the
+attributes of the edges, sorted by length. If there are none, the paths in the
+opposite direction are printed, if any. Use '--shortest K' to print only the K
+shortest paths.
+With '--reverse', print the leafs which depend on the given node, along with
+the shortest path to each of them.`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if v.GetBool("reverse") {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		d := readGraph()
+		if v.GetBool("reverse") {
+			ps, err := lib.WhyReverse(d, args[0])
+			checkErr(err)
+			for _, p := range ps {
+				fmt.Printf("[%s]\n", p.Nodes[len(p.Nodes)-1])
+				fmt.Println("  ", p)
+			}
+			return
+		}
+		from, to := args[0], args[1]
+		ps, err := lib.Why(d, from, to, v.GetInt("shortest"))
+		checkErr(err)
+		if len(ps) == 0 {
+			fmt.Printf("'%s' does not depend on '%s'\n", to, from)
+			if ps, err = lib.Why(d, to, from, v.GetInt("shortest")); err != nil || len(ps) == 0 {
+				checkErr(err)
+				fmt.Printf("no path between '%s' and '%s'\n", from, to)
+				return
+			}
+			fmt.Printf("'%s' depends on '%s' through:\n", from, to)
+		}
+		for i, p := range ps {
+			fmt.Printf("   %d: %s\n", i+1, p)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+	f := whyCmd.Flags()
+	flag, flagP := FlagFuncs(f)
+	flag("reverse", false, "list the leafs which depend on the given node")
+	flagP("shortest", "k", 0, "print only the given number of shortest paths (all if zero)")
+	for _, k := range []string{"reverse", "shortest"} {
+		checkErr(v.BindPFlag(k, f.Lookup(k)))
+	}
+}
@@ -0,0 +1,109 @@
+package dep
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// Cycle is a strongly connected component of more than one node; a set of nodes with
+// circular dependencies.
+type Cycle struct {
+	// Nodes are the DOTIDs of the nodes in the component, sorted by ID.
+	Nodes []string
+	// Back are the edges which close the cycles of the component, as found by a depth-first
+	// search. Removing all of them makes the component acyclic.
+	Back []BackEdge
+}
+
+// BackEdge is an edge which closes a cycle.
+type BackEdge struct {
+	From string
+	To   string
+	// Path is the cycle closed by the edge: the DOTIDs of the nodes from 'To' to 'From', and
+	// back to 'To'.
+	Path []string
+}
+
+// String returns the path of the cycle closed by the edge, such as 'srcA -> buildA -> srcA'.
+func (e BackEdge) String() string {
+	return strings.Join(e.Path, " -> ")
+}
+
+// Cycles returns the strongly connected components of the graph which contain cycles, computed
+// through 'topo.TarjanSCC' and sorted by the ID of their first node. The graph is a DAG if
+// none is returned. Nodes which do not implement 'DOTID() string' are identified by their ID.
+//
+// Complexity: O(V+E)
+func (d *DependencyGraph) Cycles() []Cycle {
+	cs := make([][]graph.Node, 0)
+	for _, c := range topo.TarjanSCC(d) {
+		if len(c) < 2 {
+			continue
+		}
+		sort.Slice(c, func(i, j int) bool { return c[i].ID() < c[j].ID() })
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i][0].ID() < cs[j][0].ID() })
+	o := make([]Cycle, 0, len(cs))
+	for _, c := range cs {
+		x := Cycle{Nodes: make([]string, 0, len(c))}
+		in := make(map[int64]bool, len(c))
+		for _, n := range c {
+			x.Nodes = append(x.Nodes, dotID(n))
+			in[n.ID()] = true
+		}
+		x.Back = d.backEdges(c[0], in)
+		o = append(o, x)
+	}
+	return o
+}
+
+// backEdges walks the component 'in' depth-first, starting at node 'u', and returns the edges
+// which point to a node in the current path.
+func (d *DependencyGraph) backEdges(u graph.Node, in map[int64]bool) []BackEdge {
+	o := make([]BackEdge, 0)
+	visited := make(map[int64]bool, len(in))
+	onPath := make(map[int64]int, len(in))
+	path := make([]graph.Node, 0, len(in))
+	var walk func(n graph.Node)
+	walk = func(n graph.Node) {
+		visited[n.ID()] = true
+		onPath[n.ID()] = len(path)
+		path = append(path, n)
+		ns := graph.NodesOf(d.From(n.ID()))
+		sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+		for _, v := range ns {
+			if !in[v.ID()] {
+				continue
+			}
+			if i, ok := onPath[v.ID()]; ok {
+				e := BackEdge{From: dotID(n), To: dotID(v), Path: make([]string, 0, len(path)-i+1)}
+				for _, x := range path[i:] {
+					e.Path = append(e.Path, dotID(x))
+				}
+				e.Path = append(e.Path, dotID(v))
+				o = append(o, e)
+				continue
+			}
+			if !visited[v.ID()] {
+				walk(v)
+			}
+		}
+		path = path[:len(path)-1]
+		delete(onPath, n.ID())
+	}
+	walk(u)
+	return o
+}
+
+// dotID returns the DOTID of node 'n', or its ID if it is not a DOT node.
+func dotID(n graph.Node) string {
+	if x, ok := n.(interface{ DOTID() string }); ok {
+		return x.DOTID()
+	}
+	return strconv.FormatInt(n.ID(), 10)
+}
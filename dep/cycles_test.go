@@ -0,0 +1,60 @@
+package dep
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+)
+
+func newTestGraph(t *testing.T, src string) *DependencyGraph {
+	g := dot.Unmarshal([]byte(src))
+	if g == nil {
+		t.Fatal("failed to parse DOT source")
+	}
+	return NewDependencyGraph(g)
+}
+
+func TestCyclesNone(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> objA -> buildB;
+}`)
+	if cs := d.Cycles(); len(cs) != 0 {
+		t.Errorf("expected no cycles, got %+v", cs)
+	}
+}
+
+func TestCycles(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> srcA;
+objA -> buildB -> objB -> buildC -> objA;
+buildB -> objA;
+buildA -> objA;
+}`)
+	cs := d.Cycles()
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 cycles, got %+v", cs)
+	}
+	for i, e := range []Cycle{
+		{
+			Nodes: []string{"srcA", "buildA"},
+			Back: []BackEdge{
+				{From: "buildA", To: "srcA", Path: []string{"srcA", "buildA", "srcA"}},
+			},
+		},
+		{
+			Nodes: []string{"objA", "buildB", "objB", "buildC"},
+			Back: []BackEdge{
+				{From: "buildB", To: "objA", Path: []string{"objA", "buildB", "objA"}},
+				{From: "buildC", To: "objA", Path: []string{"objA", "buildB", "objB", "buildC", "objA"}},
+			},
+		},
+	} {
+		if !reflect.DeepEqual(cs[i], e) {
+			t.Errorf("cycle %d: expected %+v, got %+v", i, e, cs[i])
+		}
+	}
+	if s := cs[0].Back[0].String(); s != "srcA -> buildA -> srcA" {
+		t.Errorf("unexpected trace %q", s)
+	}
+}
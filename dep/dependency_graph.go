@@ -1,8 +1,6 @@
 package dep
 
 import (
-	"fmt"
-
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/topo"
@@ -14,15 +12,17 @@ type DependencyGraph struct {
 	*simple.DirectedGraph
 	roots map[int64]graph.Node
 	leafs map[int64]graph.Node
+	reach *reachability
+	ids   map[string]graph.Node
 }
 
 // NewDependencyGraph returns a DependencyGraph. If 'g' is nil, a new graph is created
 // with 'simple.NewDirectedGraph'.
 func NewDependencyGraph(g *simple.DirectedGraph) *DependencyGraph {
-	if g != nil {
-		return &DependencyGraph{g, nil, nil}
+	if g == nil {
+		g = simple.NewDirectedGraph()
 	}
-	return &DependencyGraph{simple.NewDirectedGraph(), nil, nil}
+	return &DependencyGraph{DirectedGraph: g}
 }
 
 // Sort returns the topological order computed through 'topo.Sort', which implements reversed
@@ -113,6 +113,21 @@ func (d *DependencyGraph) IsMid(id int64) bool {
 	return !(d.IsRoot(id) || d.IsLeaf(id))
 }
 
+// NodeByDOTID returns the node with the given DOTID, or nil if it does not exist. Nodes which
+// do not implement 'DOTID() string' are identified by their ID. The index is built on the
+// first call; as with Roots and Leafs, the graph is not expected to be modified afterwards.
+//
+// Complexity: O(1) or O(V)
+func (d *DependencyGraph) NodeByDOTID(id string) graph.Node {
+	if d.ids == nil {
+		d.ids = make(map[string]graph.Node)
+		for _, n := range graph.NodesOf(d.Nodes()) {
+			d.ids[dotID(n)] = n
+		}
+	}
+	return d.ids[id]
+}
+
 // Induce induces a different subgraph for each of the given nodes of the dependency
 // graph, where the node is a root (walk forward) or a leaf (reverse walk).
 //
@@ -160,11 +175,9 @@ func NewInducer(d *DependencyGraph) *Inducer {
 
 // Induce walks a graph starting from a given node and generates a subgraph by copying all the
 // traversed edges (and the nodes touched by them). 'fw' and 'rv' allow to select whether a
-// forward walk is executed, a reverse walk or both of them.
+// forward walk is executed, a reverse walk or both of them. If neither of them is set, the
+// subgraph contains node 'u' only; consider using InduceDir for mid vertices.
 func (i *Inducer) Induce(d *DependencyGraph, u graph.Node, fw, rv bool) {
-	if !(fw || rv) {
-		fmt.Println("Induce called with fw=false and rv=false. This might be a mid vertex. Consider using InduceDir instead")
-	}
 	i.Reset()
 	i.Graph = NewDependencyGraph(nil)
 	i.Graph.AddNode(u)
@@ -0,0 +1,22 @@
+package dep
+
+import (
+	"testing"
+
+	"github.com/dbhi/run/dot"
+)
+
+func TestNodeByDOTID(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> objA;
+}`)
+	g := dot.Graph{DirectedGraph: d.DirectedGraph}
+	for _, x := range []string{"srcA", "buildA", "objA"} {
+		if n := d.NodeByDOTID(x); n == nil || n != g.GetNodeByDOTID(x) {
+			t.Errorf("%s: expected %v, got %v", x, g.GetNodeByDOTID(x), n)
+		}
+	}
+	if n := d.NodeByDOTID("missing"); n != nil {
+		t.Errorf("expected nil, got %v", n)
+	}
+}
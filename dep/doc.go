@@ -2,14 +2,19 @@
 Package dep provides dependency graph analysis and manipulation logic.
 
 Following the design style in `gonum/graph/flow`, type `graph.Directed` is wrapped in a new
-struct named `DependencyGraph` which includes two unexported fields:
+struct named `DependencyGraph` which includes four unexported fields:
 
 - roots: map of root nodes where the key is the ID
 - leafs: map of leaf nodes where the key is the ID
+- reach: index of the nodes that can be reached from each node, forward and in reverse, as bitsets
+- ids: map of nodes where the key is the DOTID
 
-Basic features, such as retrieving a map of roots/leafs, inducing a subgraph for a leaf or retrieving a
-valid schedule (topological sort) are already implemented. However, it'd be interesting to extend it with
-other common operations; `InduceAllIn`, `Reduce`, `Closure` and `Schedule` are on the roadmap.
+Basic features are already implemented: retrieving a map of roots/leafs, inducing a subgraph
+for a leaf, retrieving a valid schedule (topological sort) and finding cycles. The transitive
+reduction (`Reduce`) and the transitive closure (`Closure`) can be computed. There are
+reachability queries (`Reaches`, `Ancestors` and `Descendants`) and path queries (`Paths` and
+`LeafsOf`). The schedule can be split in parallel stages (`Schedule`). However, it'd be
+interesting to extend it with other common operations; `InduceAllIn` is on the roadmap.
 
 References:
   - Dependency graph: https://en.wikipedia.org/wiki/Dependency_graph
@@ -0,0 +1,135 @@
+package dep
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/traverse"
+)
+
+// reaching returns the set of nodes from which node 'v' can be reached (including 'v'), through
+// a reverse depth-first walk.
+//
+// Complexity: O(V+E)
+func (d *DependencyGraph) reaching(v graph.Node) map[int64]bool {
+	o := make(map[int64]bool)
+	var w traverse.DepthFirst
+	w.Visit = func(n graph.Node) { o[n.ID()] = true }
+	w.Walk(reversed{d}, v, nil)
+	return o
+}
+
+// Paths returns the simple paths from node 'u' to node 'v', sorted by length. If 'k' is
+// greater than zero, only the 'k' shortest paths are returned. Nodes with the same distance
+// are visited in order of ID, so the result is deterministic. The search is limited to the
+// nodes from which 'v' can be reached. Nil is returned if there is no path.
+//
+// Complexity: O(P*V) where P is the number of paths
+func (d *DependencyGraph) Paths(u, v int64, k int) [][]graph.Node {
+	a, b := d.Node(u), d.Node(v)
+	if a == nil || b == nil {
+		return nil
+	}
+	in := d.reaching(b)
+	if !in[u] {
+		return nil
+	}
+	var o [][]graph.Node
+	// Breadth-first search of partial paths, so that shorter paths are found first
+	queue := [][]graph.Node{{a}}
+	for len(queue) != 0 {
+		p := queue[0]
+		queue = queue[1:]
+		last := p[len(p)-1]
+		if last.ID() == v {
+			o = append(o, p)
+			if k > 0 && len(o) == k {
+				break
+			}
+			continue
+		}
+		ns := graph.NodesOf(d.From(last.ID()))
+		sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+		for _, n := range ns {
+			if !in[n.ID()] || onPath(p, n.ID()) {
+				continue
+			}
+			x := make([]graph.Node, len(p), len(p)+1)
+			copy(x, p)
+			queue = append(queue, append(x, n))
+		}
+	}
+	return o
+}
+
+// ShortestPaths returns a shortest path from node 'u' to each of the nodes 'vs' which can be
+// reached from it, where the key is the ID of the last node. A single breadth-first search is
+// done, which keeps the parent of each visited node. Nodes with the same distance are visited
+// in order of ID, as in Paths, so the result is deterministic.
+//
+// Complexity: O(V+E) plus sorting the successors of each node
+func (d *DependencyGraph) ShortestPaths(u int64, vs []int64) map[int64][]graph.Node {
+	o := make(map[int64][]graph.Node)
+	a := d.Node(u)
+	if a == nil {
+		return o
+	}
+	parent := map[int64]graph.Node{u: nil}
+	queue := []graph.Node{a}
+	for len(queue) != 0 {
+		n := queue[0]
+		queue = queue[1:]
+		ns := graph.NodesOf(d.From(n.ID()))
+		sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+		for _, x := range ns {
+			if _, ok := parent[x.ID()]; !ok {
+				parent[x.ID()] = n
+				queue = append(queue, x)
+			}
+		}
+	}
+	for _, v := range vs {
+		if _, ok := parent[v]; !ok {
+			continue
+		}
+		var p []graph.Node
+		for n := d.Node(v); n != nil; n = parent[n.ID()] {
+			p = append(p, n)
+		}
+		for i, j := 0, len(p)-1; i < j; i, j = i+1, j-1 {
+			p[i], p[j] = p[j], p[i]
+		}
+		o[v] = p
+	}
+	return o
+}
+
+// onPath returns true if node 'id' is in path 'p'.
+func onPath(p []graph.Node, id int64) bool {
+	for _, n := range p {
+		if n.ID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// LeafsOf returns a map containing the leafs which depend on node 'id' (i.e. the leafs that
+// can be reached through a forward depth-first walk). If the node is a leaf, it is included.
+//
+// Complexity: O(V+E)
+func (d *DependencyGraph) LeafsOf(id int64) map[int64]graph.Node {
+	o := make(map[int64]graph.Node)
+	u := d.Node(id)
+	if u == nil {
+		return o
+	}
+	var w traverse.DepthFirst
+	w.Visit = func(n graph.Node) {
+		if len(graph.NodesOf(d.From(n.ID()))) == 0 {
+			o[n.ID()] = n
+		}
+	}
+	w.Walk(d, u, nil)
+	return o
+}
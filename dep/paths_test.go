@@ -0,0 +1,81 @@
+package dep
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+// pathString returns the DOTIDs of the nodes in a path, joined with ' -> '.
+func pathString(p []graph.Node) string {
+	o := make([]string, 0, len(p))
+	for _, n := range p {
+		o = append(o, dotID(n))
+	}
+	return strings.Join(o, " -> ")
+}
+
+func TestPaths(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+getA -> srcA -> buildA -> objA -> build -> bin;
+srcB -> buildB -> objB -> build;
+objA -> buildB;
+srcDoc -> buildDoc -> doc;
+}`)
+	g := dot.Graph{DirectedGraph: d.DirectedGraph}
+	id := func(s string) int64 { return g.GetNodeByDOTID(s).ID() }
+
+	for _, x := range []struct {
+		u, v string
+		k    int
+		e    []string
+	}{
+		{"getA", "bin", 0, []string{
+			"getA -> srcA -> buildA -> objA -> build -> bin",
+			"getA -> srcA -> buildA -> objA -> buildB -> objB -> build -> bin",
+		}},
+		{"getA", "bin", 1, []string{
+			"getA -> srcA -> buildA -> objA -> build -> bin",
+		}},
+		{"objA", "objA", 0, []string{"objA"}},
+		{"bin", "getA", 0, nil},
+		{"srcDoc", "bin", 0, nil},
+	} {
+		var o []string
+		for _, p := range d.Paths(id(x.u), id(x.v), x.k) {
+			o = append(o, pathString(p))
+		}
+		if !reflect.DeepEqual(o, x.e) {
+			t.Errorf("Paths(%s, %s, %d): expected %v, got %v", x.u, x.v, x.k, x.e, o)
+		}
+	}
+
+	for _, x := range []struct {
+		n string
+		e []string
+	}{
+		{"getA", []string{"bin"}},
+		{"srcDoc", []string{"doc"}},
+		{"bin", []string{"bin"}},
+	} {
+		if o := dotIDs(d.LeafsOf(id(x.n))); !reflect.DeepEqual(o, x.e) {
+			t.Errorf("LeafsOf(%s): expected %v, got %v", x.n, x.e, o)
+		}
+	}
+	for _, x := range []struct {
+		u, v string
+		e    string
+	}{
+		{"getA", "bin", "getA -> srcA -> buildA -> objA -> build -> bin"},
+		{"getA", "objB", "getA -> srcA -> buildA -> objA -> buildB -> objB"},
+		{"objA", "objA", "objA"},
+		{"bin", "getA", ""},
+	} {
+		if o := pathString(d.ShortestPaths(id(x.u), []int64{id(x.v)})[id(x.v)]); o != x.e {
+			t.Errorf("ShortestPaths(%s, %s): expected %q, got %q", x.u, x.v, x.e, o)
+		}
+	}
+}
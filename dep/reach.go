@@ -0,0 +1,180 @@
+package dep
+
+import (
+	"math/bits"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// bitset is a set of positions in the reachability index.
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (b bitset) set(i int)      { b[i/64] |= 1 << (uint(i) % 64) }
+func (b bitset) has(i int) bool { return b[i/64]&(1<<(uint(i)%64)) != 0 }
+
+func (b bitset) or(c bitset) {
+	for i := range b {
+		b[i] |= c[i]
+	}
+}
+
+// each calls 'f' for each position in the set, in increasing order.
+func (b bitset) each(f func(i int)) {
+	for i, w := range b {
+		for w != 0 {
+			t := bits.TrailingZeros64(w)
+			f(i*64 + t)
+			w &= w - 1
+		}
+	}
+}
+
+// reachability is a precomputed index of the nodes that can be reached from each node,
+// forward (descendants) and in reverse (ancestors).
+type reachability struct {
+	// pos is the position of each node ID in 'nodes' and in the bitsets.
+	pos   map[int64]int
+	nodes []graph.Node
+	desc  []bitset
+	anc   []bitset
+}
+
+// newReachability computes the reachability index of graph 'd'. It holds two bitsets of V bits
+// per node, so it takes O(V^2/64) memory.
+//
+// Complexity: O(V*(V+E)/64)
+func newReachability(d *DependencyGraph) *reachability {
+	ns := graph.NodesOf(d.Nodes())
+	sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+	r := &reachability{pos: make(map[int64]int, len(ns)), nodes: ns}
+	for i, n := range ns {
+		r.pos[n.ID()] = i
+	}
+	r.desc = r.closure(d)
+	r.anc = r.closure(reversed{d})
+	return r
+}
+
+// closure returns the set of nodes reachable from each node of 'g'. The strongly connected
+// components are visited in reverse topological order (as returned by 'topo.TarjanSCC'), so
+// the sets of the successors are complete when a component is visited. The nodes in a
+// component with a cycle reach each other, themselves included.
+func (r *reachability) closure(g graph.Directed) []bitset {
+	o := make([]bitset, len(r.nodes))
+	for _, c := range topo.TarjanSCC(g) {
+		s := newBitset(len(r.nodes))
+		in := make(map[int64]bool, len(c))
+		for _, n := range c {
+			in[n.ID()] = true
+		}
+		for _, n := range c {
+			for _, v := range graph.NodesOf(g.From(n.ID())) {
+				p := r.pos[v.ID()]
+				s.set(p)
+				if !in[v.ID()] {
+					s.or(o[p])
+				}
+			}
+		}
+		if len(c) > 1 {
+			for _, n := range c {
+				s.set(r.pos[n.ID()])
+			}
+		}
+		for _, n := range c {
+			o[r.pos[n.ID()]] = s
+		}
+	}
+	return o
+}
+
+// nodeMap returns the nodes in set 's' as a map where the key is the ID.
+func (r *reachability) nodeMap(s bitset) map[int64]graph.Node {
+	o := make(map[int64]graph.Node)
+	s.each(func(i int) { o[r.nodes[i].ID()] = r.nodes[i] })
+	return o
+}
+
+// index returns the reachability index of the graph, which is computed on the first call. As
+// with Roots and Leafs, the graph is not expected to be modified afterwards.
+func (d *DependencyGraph) index() *reachability {
+	if d.reach == nil {
+		d.reach = newReachability(d)
+	}
+	return d.reach
+}
+
+// Reaches returns true if there is a path from node 'u' to node 'v'.
+//
+// Complexity: O(1) or O(V*(V+E)/64)
+func (d *DependencyGraph) Reaches(u, v int64) bool {
+	r := d.index()
+	i, ok := r.pos[u]
+	if !ok {
+		return false
+	}
+	j, ok := r.pos[v]
+	if !ok {
+		return false
+	}
+	return r.desc[i].has(j)
+}
+
+// Descendants returns a map containing the nodes that can be reached from the given id (i.e.
+// the nodes that depend on it).
+//
+// Complexity: O(V/64 + len(result)) or O(V*(V+E)/64)
+func (d *DependencyGraph) Descendants(id int64) map[int64]graph.Node {
+	r := d.index()
+	i, ok := r.pos[id]
+	if !ok {
+		return map[int64]graph.Node{}
+	}
+	return r.nodeMap(r.desc[i])
+}
+
+// Ancestors returns a map containing the nodes from which the given id can be reached (i.e.
+// the nodes it depends on).
+//
+// Complexity: O(V/64 + len(result)) or O(V*(V+E)/64)
+func (d *DependencyGraph) Ancestors(id int64) map[int64]graph.Node {
+	r := d.index()
+	i, ok := r.pos[id]
+	if !ok {
+		return map[int64]graph.Node{}
+	}
+	return r.nodeMap(r.anc[i])
+}
+
+// Closure returns the transitive closure of the graph; a new graph with the same nodes and
+// an edge u->v for each pair of nodes where v can be reached from u. Nodes and existing edges
+// are shared with the original graph, so attributes are kept. Added edges have no attributes.
+// Nodes in a cycle are not connected to themselves.
+//
+// Complexity: O(V^2) or O(V*(V+E)/64)
+func (d *DependencyGraph) Closure() *DependencyGraph {
+	r := d.index()
+	o := NewDependencyGraph(nil)
+	for _, n := range r.nodes {
+		o.AddNode(n)
+	}
+	for i, u := range r.nodes {
+		r.desc[i].each(func(j int) {
+			v := r.nodes[j]
+			if i == j {
+				return
+			}
+			if e := d.Edge(u.ID(), v.ID()); e != nil {
+				o.SetEdge(e)
+				return
+			}
+			o.SetEdge(simple.Edge{F: u, T: v})
+		})
+	}
+	return o
+}
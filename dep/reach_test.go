@@ -0,0 +1,99 @@
+package dep
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// dotIDs returns the DOTIDs of the nodes in a map, in lexical order.
+func dotIDs(m map[int64]graph.Node) []string {
+	o := make([]string, 0, len(m))
+	for _, n := range m {
+		o = append(o, dotID(n))
+	}
+	sort.Strings(o)
+	return o
+}
+
+func TestReachability(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+getA -> srcA -> buildA -> objA -> build -> bin;
+srcB -> buildB -> objB -> build;
+objA -> buildB;
+srcDoc -> buildDoc -> doc;
+}`)
+	g := dot.Graph{DirectedGraph: d.DirectedGraph}
+	id := func(s string) int64 { return g.GetNodeByDOTID(s).ID() }
+
+	for _, x := range []struct {
+		u, v string
+		e    bool
+	}{
+		{"getA", "bin", true},
+		{"objA", "objB", true},
+		{"srcB", "objA", false},
+		{"bin", "getA", false},
+		{"srcDoc", "bin", false},
+		{"buildA", "buildA", false},
+	} {
+		if r := d.Reaches(id(x.u), id(x.v)); r != x.e {
+			t.Errorf("Reaches(%s, %s): expected %t, got %t", x.u, x.v, x.e, r)
+		}
+	}
+
+	if x := dotIDs(d.Descendants(id("objA"))); len(x) != 4 {
+		t.Errorf("unexpected descendants of objA %v", x)
+	}
+	if x := dotIDs(d.Ancestors(id("buildB"))); len(x) != 5 || x[0] != "buildA" || x[4] != "srcB" {
+		t.Errorf("unexpected ancestors of buildB %v", x)
+	}
+	if x := d.Descendants(-1); len(x) != 0 {
+		t.Errorf("expected no descendants for unknown node, got %v", x)
+	}
+}
+
+func TestReachabilityCycle(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> objA -> srcA;
+objA -> bin;
+}`)
+	g := dot.Graph{DirectedGraph: d.DirectedGraph}
+	id := func(s string) int64 { return g.GetNodeByDOTID(s).ID() }
+	if !d.Reaches(id("buildA"), id("buildA")) || !d.Reaches(id("objA"), id("buildA")) {
+		t.Error("expected the nodes in the cycle to reach each other")
+	}
+	if x := dotIDs(d.Ancestors(id("bin"))); len(x) != 3 {
+		t.Errorf("unexpected ancestors of bin %v", x)
+	}
+}
+
+func TestClosure(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> objA;
+buildA -> log [color="red"];
+}`)
+	c := d.Closure()
+	e := []string{"buildA->log", "buildA->objA", "srcA->buildA", "srcA->log", "srcA->objA"}
+	x := edgeList(c)
+	if len(x) != len(e) {
+		t.Fatalf("expected edges %v, got %v", e, x)
+	}
+	for i := range e {
+		if x[i] != e[i] {
+			t.Errorf("expected edges %v, got %v", e, x)
+			break
+		}
+	}
+	g := dot.Graph{DirectedGraph: c.DirectedGraph}
+	u, v := g.GetNodeByDOTID("buildA"), g.GetNodeByDOTID("log")
+	if a := c.Edge(u.ID(), v.ID()).(encoding.Attributer).Attributes(); len(a) != 1 || a[0].Value != "red" {
+		t.Errorf("expected edge attributes to be kept, got %v", a)
+	}
+	if len(graph.EdgesOf(d.Edges())) != 3 {
+		t.Error("expected the original graph not to be modified")
+	}
+}
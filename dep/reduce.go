@@ -0,0 +1,41 @@
+package dep
+
+import (
+	"gonum.org/v1/gonum/graph"
+)
+
+// Reduce returns the transitive reduction of the graph; a new graph with the same nodes and
+// without redundant edges. An edge u->v is redundant if v can be reached from u through a
+// longer path. Nodes and edges are shared with the original graph, so attributes are kept.
+// On failure, the error of Sort is returned, because the reduction of a graph with cycles
+// is not unique.
+//
+// Complexity: O(sum of outdegree(u)^2), which is O(V*E) at most, since each pair of
+// successors is checked in constant time through the reachability index (see Reaches). If
+// the index is not computed yet, building it takes O(V*(V+E)/64) time and O(V^2/64) memory.
+func (d *DependencyGraph) Reduce() (*DependencyGraph, error) {
+	s, err := d.Sort()
+	if err != nil {
+		return nil, err
+	}
+	o := NewDependencyGraph(nil)
+	for _, n := range s {
+		o.AddNode(n)
+	}
+	for _, u := range s {
+		vs := graph.NodesOf(d.From(u.ID()))
+		for _, v := range vs {
+			redundant := false
+			for _, w := range vs {
+				if w.ID() != v.ID() && d.Reaches(w.ID(), v.ID()) {
+					redundant = true
+					break
+				}
+			}
+			if !redundant {
+				o.SetEdge(d.Edge(u.ID(), v.ID()))
+			}
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,62 @@
+package dep
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// edgeList returns the edges of a graph as sorted 'from->to' strings.
+func edgeList(d *DependencyGraph) []string {
+	o := make([]string, 0)
+	for _, e := range graph.EdgesOf(d.Edges()) {
+		o = append(o, dotID(e.From())+"->"+dotID(e.To()))
+	}
+	sort.Strings(o)
+	return o
+}
+
+func TestReduce(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcC   [type="SRC"];
+build  [type="JOB"];
+srcC -> buildC -> objC -> build;
+srcC -> build [color="red"];
+objC -> build [color="blue"];
+buildC -> build;
+}`)
+	r, err := d.Reduce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, m := len(graph.NodesOf(r.Nodes())), len(graph.NodesOf(d.Nodes())); n != m {
+		t.Errorf("expected %d nodes, got %d", m, n)
+	}
+	e := []string{"buildC->objC", "objC->build", "srcC->buildC"}
+	if x := edgeList(r); len(x) != len(e) || x[0] != e[0] || x[1] != e[1] || x[2] != e[2] {
+		t.Errorf("expected edges %v, got %v", e, x)
+	}
+	g := dot.Graph{DirectedGraph: r.DirectedGraph}
+	u, v := g.GetNodeByDOTID("objC"), g.GetNodeByDOTID("build")
+	if a := r.Edge(u.ID(), v.ID()).(encoding.Attributer).Attributes(); len(a) != 1 || a[0].Value != "blue" {
+		t.Errorf("expected edge attributes to be kept, got %v", a)
+	}
+	if a, err := v.(*dot.Node).Attribute("type"); err != nil || a != "JOB" {
+		t.Errorf("expected node attributes to be kept, got %q (%v)", a, err)
+	}
+	if len(graph.EdgesOf(d.Edges())) != 5 {
+		t.Error("expected the original graph not to be modified")
+	}
+}
+
+func TestReduceCycle(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> srcA;
+}`)
+	if _, err := d.Reduce(); err == nil {
+		t.Error("expected an error")
+	}
+}
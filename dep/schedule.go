@@ -0,0 +1,101 @@
+package dep
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// Schedule splits the topological order in stages, through the Coffman–Graham algorithm.
+// All the predecessors of a node are in previous stages, so the nodes in a stage can be
+// processed at the same time. If 'width' is greater than zero, each stage contains at most
+// 'width' nodes; otherwise, the number of nodes per stage is not limited. The nodes in each
+// stage are sorted by ID. Nil is returned if the graph has cycles.
+//
+// Complexity: O(V^2) or O(V*(V+E)/64)
+func (d *DependencyGraph) Schedule(width int) [][]graph.Node {
+	r, err := d.Reduce()
+	if err != nil {
+		return nil
+	}
+	ns := graph.NodesOf(r.Nodes())
+	if width <= 0 {
+		width = len(ns)
+	}
+
+	// Order the nodes so that each node is placed after all of its predecessors, and the
+	// ones whose latest predecessors were placed earlier go first.
+	pos := make(map[int64]int, len(ns))
+	key := func(n graph.Node) []int {
+		o := make([]int, 0)
+		for _, p := range graph.NodesOf(r.To(n.ID())) {
+			o = append(o, pos[p.ID()])
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(o)))
+		return o
+	}
+	less := func(a, b []int) bool {
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if a[i] != b[i] {
+				return a[i] < b[i]
+			}
+		}
+		return len(a) < len(b)
+	}
+	ready := func(n graph.Node) bool {
+		for _, p := range graph.NodesOf(r.To(n.ID())) {
+			if _, ok := pos[p.ID()]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+	order := make([]graph.Node, 0, len(ns))
+	for len(order) < len(ns) {
+		var next graph.Node
+		var k []int
+		for _, n := range ns {
+			if _, ok := pos[n.ID()]; ok || !ready(n) {
+				continue
+			}
+			x := key(n)
+			if next == nil || less(x, k) || (!less(k, x) && n.ID() < next.ID()) {
+				next, k = n, x
+			}
+		}
+		pos[next.ID()] = len(order)
+		order = append(order, next)
+	}
+
+	// Assign levels in reverse order; each node goes to the lowest level above all of its
+	// successors which is not full. Level 0 is the last stage.
+	level := make(map[int64]int, len(ns))
+	count := make([]int, 0)
+	for i := len(order) - 1; i >= 0; i-- {
+		n := order[i]
+		l := 0
+		for _, s := range graph.NodesOf(r.From(n.ID())) {
+			if x := level[s.ID()] + 1; x > l {
+				l = x
+			}
+		}
+		for l < len(count) && count[l] >= width {
+			l++
+		}
+		if l == len(count) {
+			count = append(count, 0)
+		}
+		count[l]++
+		level[n.ID()] = l
+	}
+
+	o := make([][]graph.Node, len(count))
+	for _, n := range order {
+		x := len(count) - 1 - level[n.ID()]
+		o[x] = append(o[x], n)
+	}
+	for _, s := range o {
+		sort.Slice(s, func(i, j int) bool { return s[i].ID() < s[j].ID() })
+	}
+	return o
+}
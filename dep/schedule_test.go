@@ -0,0 +1,96 @@
+package dep
+
+import (
+	"testing"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// stageIDs returns the DOTIDs of the nodes in each stage.
+func stageIDs(ss [][]graph.Node) [][]string {
+	o := make([][]string, 0, len(ss))
+	for _, s := range ss {
+		x := make([]string, 0, len(s))
+		for _, n := range s {
+			x = append(x, dotID(n))
+		}
+		o = append(o, x)
+	}
+	return o
+}
+
+func TestSchedule(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+a -> d;
+b -> d;
+c -> e;
+a -> e;
+d -> f;
+e -> f;
+a -> f;
+}`)
+	for _, x := range []struct {
+		width int
+		e     [][]string
+	}{
+		{0, [][]string{{"a", "b", "c"}, {"d", "e"}, {"f"}}},
+		{2, [][]string{{"a"}, {"b", "c"}, {"d", "e"}, {"f"}}},
+		{1, [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}, {"f"}}},
+	} {
+		ss := stageIDs(d.Schedule(x.width))
+		if len(ss) != len(x.e) {
+			t.Errorf("width %d: expected %v, got %v", x.width, x.e, ss)
+			continue
+		}
+		for i := range ss {
+			if len(ss[i]) != len(x.e[i]) {
+				t.Errorf("width %d: expected %v, got %v", x.width, x.e, ss)
+				break
+			}
+			for j := range ss[i] {
+				if ss[i][j] != x.e[i][j] {
+					t.Errorf("width %d: expected %v, got %v", x.width, x.e, ss)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestScheduleOrder(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+getA -> srcA -> buildA -> objA -> build -> bin;
+srcB -> buildB -> objB -> build;
+objA -> buildB;
+srcC -> build;
+srcDoc -> buildDoc -> doc;
+}`)
+	for _, w := range []int{0, 1, 2, 3} {
+		stage := make(map[int64]int)
+		for i, s := range d.Schedule(w) {
+			if w > 0 && len(s) > w {
+				t.Errorf("width %d: stage %d has %d nodes", w, i, len(s))
+			}
+			for _, n := range s {
+				stage[n.ID()] = i
+			}
+		}
+		if len(stage) != len(graph.NodesOf(d.Nodes())) {
+			t.Errorf("width %d: expected all the nodes to be scheduled, got %d", w, len(stage))
+		}
+		for _, e := range graph.EdgesOf(d.Edges()) {
+			if stage[e.From().ID()] >= stage[e.To().ID()] {
+				t.Errorf("width %d: %s is not scheduled before %s", w, dotID(e.From()), dotID(e.To()))
+			}
+		}
+	}
+}
+
+func TestScheduleCycle(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA -> buildA -> srcA;
+}`)
+	if ss := d.Schedule(0); ss != nil {
+		t.Errorf("expected nil, got %v", stageIDs(ss))
+	}
+}
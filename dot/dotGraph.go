@@ -24,8 +24,11 @@ func (g Graph) NewEdge(from, to graph.Node) graph.Edge {
 	return &dotEdge{Edge: g.DirectedGraph.NewEdge(from, to), attrs: make(map[string]string)}
 }
 
-// GetNodeByDOTID gets a Node by it's DOT ID.
+// GetNodeByDOTID gets a Node by it's DOT ID. Nodes in namespaces are identified by the
+// qualified DOTID (e.g. 'fpga::build'); a leading separator refers to the root namespace
+// (see Qualify).
 func (g Graph) GetNodeByDOTID(DOTID string) graph.Node {
+	DOTID = Qualify("", DOTID)
 	for _, n := range graph.NodesOf(g.Nodes()) {
 		if n.(*Node).DOTID() == DOTID {
 			return n
@@ -101,16 +104,26 @@ func (e *dotEdge) ReversedEdge() graph.Edge {
 // Unmarshal reads a slice of bytes containing a dot encoded graph and returns a
 // *simple.DirectedGraph with edges and nodes containing attributes
 func Unmarshal(b []byte) *simple.DirectedGraph {
-	g := simple.NewDirectedGraph()
-	if err := dot.Unmarshal(b, Graph{g}); err != nil {
+	g, err := Parse(b)
+	if err != nil {
 		return nil
 	}
 	return g
 }
 
-// Marshal returns the DOT encoding for the graph g
+// Parse is the same as Unmarshal, but the error of the decoder is returned.
+func Parse(b []byte) (*simple.DirectedGraph, error) {
+	g := simple.NewDirectedGraph()
+	if err := dot.Unmarshal(b, Graph{g}); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Marshal returns the DOT encoding for the graph g. The nodes of each namespace are grouped
+// in a cluster subgraph (see NamespaceSep).
 func Marshal(g graph.Graph) []byte {
-	b, err := dot.Marshal(g, "", "", "")
+	b, err := dot.Marshal(withClusters(g), "", "", "")
 	if err != nil {
 		return nil
 	}
@@ -0,0 +1,113 @@
+package dot
+
+import (
+	"sort"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/encoding/dot"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// NamespaceSep separates the namespace from the name in a DOTID (e.g. 'fpga::build').
+// Namespaces can be nested (e.g. 'soc::fpga::build').
+const NamespaceSep = "::"
+
+// SplitNamespace returns the namespace and the name of a DOTID. The namespace of nodes in the
+// root namespace is empty.
+func SplitNamespace(id string) (string, string) {
+	if i := strings.LastIndex(id, NamespaceSep); i >= 0 {
+		return id[:i], id[i+len(NamespaceSep):]
+	}
+	return "", id
+}
+
+// Qualify returns the DOTID of name 'id' in namespace 'ns'. Names which contain a separator
+// are absolute, so they are returned as is; a leading separator refers to the root namespace
+// (e.g. '::pack' is 'pack').
+func Qualify(ns, id string) string {
+	if strings.HasPrefix(id, NamespaceSep) {
+		return id[len(NamespaceSep):]
+	}
+	if ns == "" || strings.Contains(id, NamespaceSep) {
+		return id
+	}
+	return ns + NamespaceSep + id
+}
+
+// Namespace returns the namespace of the node (see SplitNamespace).
+func (n *Node) Namespace() string {
+	ns, _ := SplitNamespace(n.dotID)
+	return ns
+}
+
+// namespaced wraps a graph to define a cluster subgraph for each namespace.
+type namespaced struct {
+	graph.Directed
+	clusters []dot.Graph
+}
+
+// Structure returns the clusters of the graph, which implements dot.Structurer.
+func (g namespaced) Structure() []dot.Graph { return g.clusters }
+
+// cluster is a subgraph which contains the nodes of a namespace.
+type cluster struct {
+	*simple.DirectedGraph
+	ns string
+}
+
+// DOTID returns the name of the subgraph; Graphviz draws subgraphs named 'cluster*' as boxes.
+func (c cluster) DOTID() string { return "cluster_" + c.ns }
+
+// DOTAttributers returns the attributes of the subgraph, which is labeled with the namespace.
+func (c cluster) DOTAttributers() (g, n, e encoding.Attributer) {
+	return attributes{{Key: "label", Value: c.ns}}, attributes{}, attributes{}
+}
+
+type attributes []encoding.Attribute
+
+func (a attributes) Attributes() []encoding.Attribute { return a }
+
+// ref refers to a node in a cluster, without repeating its attributes.
+type ref struct {
+	graph.Node
+	id string
+}
+
+func (r ref) DOTID() string { return r.id }
+
+// withClusters returns 'g' along with a cluster subgraph for each namespace, sorted by name.
+// If all the nodes are in the root namespace, 'g' is returned as is.
+func withClusters(g graph.Graph) graph.Graph {
+	d, ok := g.(graph.Directed)
+	if !ok {
+		return g
+	}
+	m := make(map[string]*simple.DirectedGraph)
+	for _, n := range graph.NodesOf(g.Nodes()) {
+		x, ok := n.(*Node)
+		if !ok || x.Namespace() == "" {
+			continue
+		}
+		c, ok := m[x.Namespace()]
+		if !ok {
+			c = simple.NewDirectedGraph()
+			m[x.Namespace()] = c
+		}
+		c.AddNode(ref{Node: x.Node, id: x.DOTID()})
+	}
+	if len(m) == 0 {
+		return g
+	}
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	cs := make([]dot.Graph, 0, len(ks))
+	for _, k := range ks {
+		cs = append(cs, cluster{DirectedGraph: m[k], ns: k})
+	}
+	return namespaced{Directed: d, clusters: cs}
+}
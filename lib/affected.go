@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+// git executes git with the given arguments in 'dir' (or the current directory, if empty),
+// and it returns the stdout.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// ChangedFiles returns the sorted list of files which changed in the git repository since
+// revision 'since': modified, added or deleted files (including uncommitted changes), and
+// untracked files which are not ignored. Renamed files are reported through both the old and
+// the new path, since both of them might be sources. Only files in 'dir' (or the current directory, if
+// empty) are returned, and the paths are relative to it.
+func ChangedFiles(dir, since string) ([]string, error) {
+	m := make(map[string]bool)
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--no-renames", "--relative", since, "--"},
+		{"ls-files", "--others", "--exclude-standard"},
+	} {
+		o, err := git(dir, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range strings.Split(o, "\n") {
+			if f != "" {
+				m[filepath.FromSlash(f)] = true
+			}
+		}
+	}
+	o := make([]string, 0, len(m))
+	for k := range m {
+		o = append(o, k)
+	}
+	sort.Strings(o)
+	return o, nil
+}
+
+// ReadGraphFromRevision reads DOT file 'f' as it was in revision 'rev' of the git repository
+// (e.g. 'HEAD~1'). The path of the file is relative to 'dir' (or the current directory, if
+// empty).
+func ReadGraphFromRevision(dir, rev, f string) (*dep.DependencyGraph, error) {
+	b, err := git(dir, "show", rev+":./"+filepath.ToSlash(f))
+	if err != nil {
+		return nil, err
+	}
+	d, err := ParseGraph([]byte(b))
+	if err != nil {
+		err.(*ParseError).File = rev + ":" + f
+		return nil, err
+	}
+	return d, nil
+}
+
+// matchData returns true if file 'f' is matched by data pattern 'p', or if it is inside a
+// directory matched by 'p'. Files which do not exist (e.g. deleted ones) can be matched.
+func matchData(p, f string) bool {
+	p, f = filepath.Clean(p), filepath.Clean(f)
+	for x := f; x != "." && x != string(filepath.Separator); x = filepath.Dir(x) {
+		if ok, _ := filepath.Match(p, x); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Affected is the result of matching a list of changed files against the sources of a graph.
+type Affected struct {
+	// Files are the changed files which are matched by the data of any source.
+	Files []string
+	// Sources are the DOTIDs of the SRC nodes whose data changed, sorted by ID.
+	Sources []string
+	// Jobs are the DOTIDs of the tasks which depend on the sources, in topological order.
+	Jobs []string
+	// Leafs are the DOTIDs of the leafs which depend on the sources, sorted by ID.
+	Leafs []string
+}
+
+// Selection returns a selection expression (see ParseSelection) for the nodes which depend on
+// the affected sources, such as 'srcA>,srcB>'. The DOTIDs are quoted if needed (see
+// QuoteNode). It is empty if no source is affected.
+func (a *Affected) Selection() string {
+	o := make([]string, 0, len(a.Sources))
+	for _, s := range a.Sources {
+		o = append(o, QuoteNode(s)+">")
+	}
+	return strings.Join(o, ",")
+}
+
+// AffectedBy returns the sources of 'd' (nodes of type SRC) whose 'data' patterns in 'cfg'
+// match any of the given files, along with the jobs and leafs which depend on them. The
+// patterns are rendered as in GetTasks, and they are compared with paths relative to the
+// same directory.
+func AffectedBy(d *dep.DependencyGraph, cfg *Config, files []string) (*Affected, error) {
+	ns := graph.NodesOf(d.Nodes())
+	sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+	a := &Affected{
+		Files:   make([]string, 0),
+		Sources: make([]string, 0),
+		Jobs:    make([]string, 0),
+		Leafs:   make([]string, 0),
+	}
+	fm := make(map[string]bool)
+	srcs := make(map[int64]graph.Node)
+	for _, n := range ns {
+		x := n.(*dot.Node)
+		if nodeType(x) != "SRC" {
+			continue
+		}
+		ps, err := cfg.data(x)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			for _, p := range ps {
+				if matchData(p, f) {
+					fm[f] = true
+					srcs[x.ID()] = x
+				}
+			}
+		}
+		if srcs[x.ID()] != nil {
+			a.Sources = append(a.Sources, x.DOTID())
+		}
+	}
+	for _, f := range files {
+		if fm[f] {
+			a.Files = append(a.Files, f)
+		}
+	}
+	if len(srcs) == 0 {
+		return a, nil
+	}
+	m := make(map[string]*dep.DependencyGraph)
+	for k, s := range d.InduceDir(srcs, true, false) {
+		m[fmt.Sprint(k)] = s
+	}
+	u := union(m)
+	var err error
+	if a.Jobs, err = GetTaskList(u); err != nil {
+		return nil, err
+	}
+	for _, n := range ns {
+		if u.Node(n.ID()) != nil && d.IsLeaf(n.ID()) {
+			a.Leafs = append(a.Leafs, n.(*dot.Node).DOTID())
+		}
+	}
+	return a, nil
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAffected(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=run", "-c", "user.email=run@localhost"}, args...)...)
+		cmd.Dir = dir
+		if o, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, o)
+		}
+	}
+	write := func(n, s string) {
+		p := filepath.Join(dir, n)
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("src/proto/a.c", "a")
+	write("src/plugin/b.c", "b")
+	write("doc/index.md", "doc")
+	git("init", "-q")
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+
+	d, err := ReadGraphFromFile("../example/graph.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadConfigFile("../example/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	affected := func() *Affected {
+		fs, err := ChangedFiles(dir, "HEAD")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := AffectedBy(d, cfg, fs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+
+	if a := affected(); len(a.Files) != 0 || len(a.Jobs) != 0 || a.Selection() != "" {
+		t.Errorf("expected nothing to be affected, got %+v", a)
+	}
+
+	write("src/plugin/b.c", "c")
+	write("notes.txt", "untracked, but not a source")
+	a := affected()
+	e := &Affected{
+		Files:   []string{filepath.Join("src", "plugin", "b.c")},
+		Sources: []string{"srcB"},
+		Jobs:    []string{"buildB", "build"},
+		Leafs:   []string{"bin"},
+	}
+	if !reflect.DeepEqual(a, e) {
+		t.Errorf("expected %+v, got %+v", e, a)
+	}
+
+	write("doc/new.md", "untracked")
+	if a := affected(); a.Selection() != "srcB>,srcDoc>" {
+		t.Errorf("expected selection 'srcB>,srcDoc>', got '%s'", a.Selection())
+	}
+
+	// Both paths of a renamed file are changed
+	git("add", "-A")
+	git("commit", "-q", "-m", "changes")
+	git("mv", "src/proto/a.c", "a.c")
+	fs, err := ChangedFiles(dir, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := []string{"a.c", filepath.Join("src", "proto", "a.c")}; !reflect.DeepEqual(fs, e) {
+		t.Errorf("expected %v, got %v", e, fs)
+	}
+
+	if _, err := ChangedFiles(dir, "unknown"); err == nil {
+		t.Error("expected an error for an unknown revision")
+	}
+}
+
+func TestMatchData(t *testing.T) {
+	for _, x := range []struct {
+		p, f string
+		e    bool
+	}{
+		{"./src/proto/*.c", "src/proto/a.c", true},
+		{"./src/proto/*.c", "src/proto/a.h", false},
+		{"./doc", "doc/sub/index.md", true},
+		{"./src/*", "src/main/main.c", true},
+		{"./src/main/*", "src/plugin/b.c", false},
+	} {
+		if o := matchData(x.p, filepath.FromSlash(x.f)); o != x.e {
+			t.Errorf("matchData(%s, %s): expected %t, got %t", x.p, x.f, x.e, o)
+		}
+	}
+}
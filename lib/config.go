@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config is the content of a configuration file.
+type Config struct {
+	// Graph is the DOT file, or the list of DOT files which are merged (see ReadGraphsFromFiles).
+	Graph Files `json:"graph" mapstructure:"graph"`
+	// Edges are added to the graph after merging the files; typically, between namespaces.
+	Edges []Edge `json:"edges" mapstructure:"edges"`
+	// Vars are available in the templates of all the jobs.
+	Vars map[string]string `json:"vars" mapstructure:"vars"`
+	Jobs Jobs              `json:"jobs" mapstructure:"jobs"`
+}
+
+// ReadConfigFile reads a JSON configuration file. Unlike configuration managers (such as
+// viper), the case of the keys is preserved (e.g. the names of environment variables).
+func ReadConfigFile(f string) (*Config, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", f, err)
+	}
+	return c, nil
+}
+
+// Files is a list of file names. In JSON, a single name can be given as a string.
+type Files []string
+
+// UnmarshalJSON decodes either a string or a list of strings.
+func (f *Files) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*f = Files{s}
+		return nil
+	}
+	var l []string
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	*f = l
+	return nil
+}
+
+// Edge is an edge between two nodes of the graph, given by the qualified DOTIDs (e.g. from
+// 'fpga::bit' to 'pack').
+type Edge struct {
+	From  string            `json:"from" mapstructure:"from"`
+	To    string            `json:"to" mapstructure:"to"`
+	Attrs map[string]string `json:"attrs" mapstructure:"attrs"`
+}
+
+// Job is the context of a node, as defined in field 'jobs' of a configuration file.
+type Job struct {
+	Description string            `json:"description" mapstructure:"description"`
+	Data        []string          `json:"data" mapstructure:"data"`
+	Cmds        []string          `json:"cmds" mapstructure:"cmds"`
+	Env         map[string]string `json:"env" mapstructure:"env"`
+	// Vars are available in the templates of the job, and they override Config.Vars.
+	Vars map[string]string `json:"vars" mapstructure:"vars"`
+	// AllowFailure makes the jobs which depend on this one to be executed even if it fails.
+	AllowFailure bool `json:"allow_failure" mapstructure:"allow_failure"`
+	// Timeout is the maximum duration of the job, in the format of time.ParseDuration (e.g. '10m').
+	Timeout string `json:"timeout" mapstructure:"timeout"`
+	// Retries is the number of times that the job is executed again after failing.
+	Retries int `json:"retries" mapstructure:"retries"`
+	// RetryDelay is the time to wait before the first retry, in the format of
+	// time.ParseDuration. It is doubled for each retry (exponential backoff).
+	RetryDelay string `json:"retry_delay" mapstructure:"retry_delay"`
+	// RetryOn are the exit codes that trigger a retry. If empty, any failure does.
+	RetryOn []int `json:"retry_on" mapstructure:"retry_on"`
+}
+
+// Jobs is a map of Job, where the key has format 'TYPE|DOTID' (e.g. 'JOB|buildA').
+type Jobs map[string]Job
+
+// Get returns the Job for a node of the given type and DOTID. Keys are compared
+// case-insensitively, because configuration managers (such as viper) might lower them.
+func (j Jobs) Get(t, id string) (Job, bool) {
+	k := t + "|" + id
+	if x, ok := j[k]; ok {
+		return x, true
+	}
+	for x, v := range j {
+		if strings.EqualFold(x, k) {
+			return v, true
+		}
+	}
+	return Job{}, false
+}
+
+// shellCmd returns the command to execute the given lines as a single shell script, so that
+// the context (e.g. 'cd') is kept between lines. The script stops at the first failure.
+func shellCmd(lines []string) []string {
+	return []string{"sh", "-e", "-c", strings.Join(lines, "\n")}
+}
+
+// shellScript returns the lines of a command created with shellCmd, or nil otherwise.
+func shellScript(c []string) []string {
+	p := shellCmd(nil)
+	if len(c) != len(p) {
+		return nil
+	}
+	for i := range p[:len(p)-1] {
+		if c[i] != p[i] {
+			return nil
+		}
+	}
+	return strings.Split(c[len(c)-1], "\n")
+}
@@ -0,0 +1,283 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// AttrChange is a DOT attribute which was added, removed or modified. Old is empty if the
+// attribute was added, and New is empty if it was removed.
+type AttrChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+func (c AttrChange) String() string {
+	f := func(s string) string {
+		if s == "" {
+			return "(none)"
+		}
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Key, f(c.Old), f(c.New))
+}
+
+// ElementChange are the attribute changes of a node, or of an edge ('FROM -> TO').
+type ElementChange struct {
+	Element string       `json:"element"`
+	Attrs   []AttrChange `json:"attrs"`
+}
+
+// JobChange is a job which exists in both graphs, but whose induced subgraph (the nodes it
+// depends on, and the edges between them) or stage (see Stages) changed. Stages are numbered
+// from 1.
+type JobChange struct {
+	DOTID    string `json:"id"`
+	Subgraph bool   `json:"subgraph"`
+	OldStage int    `json:"old_stage"`
+	NewStage int    `json:"new_stage"`
+}
+
+func (c JobChange) String() string {
+	o := make([]string, 0, 2)
+	if c.Subgraph {
+		o = append(o, "subgraph changed")
+	}
+	if c.OldStage != c.NewStage {
+		o = append(o, fmt.Sprintf("stage %d -> %d", c.OldStage, c.NewStage))
+	}
+	return c.DOTID + ": " + strings.Join(o, ", ")
+}
+
+// Diff is the structural difference between two graphs, where nodes are identified by DOTID
+// and edges by the DOTIDs of both ends ('FROM -> TO'). All the lists are sorted.
+type Diff struct {
+	AddedNodes   []string        `json:"added_nodes"`
+	RemovedNodes []string        `json:"removed_nodes"`
+	AddedEdges   []string        `json:"added_edges"`
+	RemovedEdges []string        `json:"removed_edges"`
+	Changed      []ElementChange `json:"changed"`
+	Jobs         []JobChange     `json:"jobs"`
+	// Cyclic is true if any of the graphs is not acyclic. Then, stages are not computed, so
+	// the stages of the jobs are zero and only changes of the subgraphs are reported.
+	Cyclic bool `json:"cyclic,omitempty"`
+}
+
+// Empty returns true if the graphs are equal.
+func (d *Diff) Empty() bool {
+	return len(d.AddedNodes)+len(d.RemovedNodes)+len(d.AddedEdges)+len(d.RemovedEdges)+len(d.Changed)+len(d.Jobs) == 0
+}
+
+// elements returns the nodes and the edges of 'd', where the key is the DOTID of the node or
+// 'FROM -> TO' for edges.
+func elements(d *dep.DependencyGraph) (map[string]*dot.Node, map[string]graph.Edge) {
+	ns := make(map[string]*dot.Node)
+	for _, n := range graph.NodesOf(d.Nodes()) {
+		ns[n.(*dot.Node).DOTID()] = n.(*dot.Node)
+	}
+	es := make(map[string]graph.Edge)
+	for _, e := range graph.EdgesOf(d.Edges()) {
+		es[edgeName(e)] = e
+	}
+	return ns, es
+}
+
+func edgeName(e graph.Edge) string {
+	return e.From().(*dot.Node).DOTID() + " -> " + e.To().(*dot.Node).DOTID()
+}
+
+// attrMaps returns the DOT attributes of the nodes and the edges of 'd' (see elements).
+func attrMaps(d *dep.DependencyGraph) (map[string]map[string]string, map[string]map[string]string) {
+	f := func(x encoding.Attributer) map[string]string {
+		o := make(map[string]string)
+		for _, v := range x.Attributes() {
+			o[v.Key] = v.Value
+		}
+		return o
+	}
+	ns, es := elements(d)
+	na, ea := make(map[string]map[string]string), make(map[string]map[string]string)
+	for k, n := range ns {
+		na[k] = f(n)
+	}
+	for k, e := range es {
+		if x, ok := e.(encoding.Attributer); ok {
+			ea[k] = f(x)
+		} else {
+			ea[k] = map[string]string{}
+		}
+	}
+	return na, ea
+}
+
+// attrChanges returns the changes between attributes 'a' and 'b', sorted by key.
+func attrChanges(a, b map[string]string) []AttrChange {
+	o := make([]AttrChange, 0)
+	for k, v := range a {
+		if b[k] != v {
+			o = append(o, AttrChange{Key: k, Old: v, New: b[k]})
+		}
+	}
+	for k, v := range b {
+		if _, ok := a[k]; !ok {
+			o = append(o, AttrChange{Key: k, New: v})
+		}
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].Key < o[j].Key })
+	return o
+}
+
+// diffElements returns the elements (see attrMaps) which were removed from 'a' and added to
+// 'b', sorted, along with the changes of the attributes of those in both.
+func diffElements(a, b map[string]map[string]string) ([]string, []string, []ElementChange) {
+	rm, add, ch := make([]string, 0), make([]string, 0), make([]ElementChange, 0)
+	for k, x := range a {
+		y, ok := b[k]
+		if !ok {
+			rm = append(rm, k)
+			continue
+		}
+		if cs := attrChanges(x, y); len(cs) != 0 {
+			ch = append(ch, ElementChange{Element: k, Attrs: cs})
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			add = append(add, k)
+		}
+	}
+	sort.Strings(rm)
+	sort.Strings(add)
+	sort.Slice(ch, func(i, j int) bool { return ch[i].Element < ch[j].Element })
+	return rm, add, ch
+}
+
+// inducedSignature returns a description of the subgraph of the nodes which job 'n' depends
+// on, so that two subgraphs are equal if their signatures are equal.
+func inducedSignature(d *dep.DependencyGraph, n graph.Node) string {
+	m := d.Ancestors(n.ID())
+	m[n.ID()] = n
+	o := make([]string, 0)
+	for _, x := range m {
+		o = append(o, x.(*dot.Node).DOTID())
+		for _, y := range graph.NodesOf(d.From(x.ID())) {
+			if _, ok := m[y.ID()]; ok {
+				o = append(o, edgeName(d.Edge(x.ID(), y.ID())))
+			}
+		}
+	}
+	sort.Strings(o)
+	return strings.Join(o, "\n")
+}
+
+// stageOf returns the stage (from 1) of each job of 'd' (see Stages).
+func stageOf(d *dep.DependencyGraph) (map[string]int, error) {
+	ss, err := Stages(d, 0)
+	if err != nil {
+		return nil, err
+	}
+	o := make(map[string]int)
+	for i, s := range ss {
+		for _, j := range s {
+			o[j] = i + 1
+		}
+	}
+	return o, nil
+}
+
+// DiffGraphs returns the structural difference between graphs 'a' (old) and 'b' (new). If any
+// of them is not acyclic, the stages of the jobs are not compared (see Diff.Cyclic).
+func DiffGraphs(a, b *dep.DependencyGraph) (*Diff, error) {
+	o := &Diff{Jobs: make([]JobChange, 0)}
+	sa, err := stageOf(a)
+	if err != nil && !errors.Is(err, ErrCycle) {
+		return nil, err
+	}
+	sb, err2 := stageOf(b)
+	if err2 != nil && !errors.Is(err2, ErrCycle) {
+		return nil, err2
+	}
+	if err != nil || err2 != nil {
+		o.Cyclic, sa, sb = true, nil, nil
+	}
+	na, ea := attrMaps(a)
+	nb, eb := attrMaps(b)
+	var cn, ce []ElementChange
+	o.RemovedNodes, o.AddedNodes, cn = diffElements(na, nb)
+	o.RemovedEdges, o.AddedEdges, ce = diffElements(ea, eb)
+	o.Changed = append(cn, ce...)
+	for _, n := range graph.NodesOf(b.Nodes()) {
+		x := n.(*dot.Node)
+		k := x.DOTID()
+		y := a.NodeByDOTID(k)
+		if !isJob(x) || y == nil || !isJob(y.(*dot.Node)) {
+			continue
+		}
+		c := JobChange{
+			DOTID:    k,
+			Subgraph: inducedSignature(a, y) != inducedSignature(b, x),
+			OldStage: sa[k],
+			NewStage: sb[k],
+		}
+		if c.Subgraph || c.OldStage != c.NewStage {
+			o.Jobs = append(o.Jobs, c)
+		}
+	}
+	sort.Slice(o.Jobs, func(i, j int) bool { return o.Jobs[i].DOTID < o.Jobs[j].DOTID })
+	return o, nil
+}
+
+// Colors of the elements in the graph returned by DiffGraph.
+const (
+	DiffAdded   = "green"
+	DiffRemoved = "red"
+	DiffChanged = "orange"
+	DiffJob     = "blue"
+)
+
+// DiffGraph returns the union of graphs 'a' (old) and 'b' (new), where the changes in 'd' (see
+// DiffGraphs) are colored: added nodes and edges are DiffAdded, removed ones are DiffRemoved
+// (and dashed), those whose attributes changed are DiffChanged, and jobs whose subgraph or
+// stage changed are DiffJob. The attributes of graph 'b' are kept.
+func DiffGraph(a, b *dep.DependencyGraph, d *Diff) *dep.DependencyGraph {
+	u, _ := Merge(b, a)
+	ns, es := elements(u)
+	set := func(x interface{}, color string, dashed bool) {
+		s := x.(encoding.AttributeSetter)
+		_ = s.SetAttribute(encoding.Attribute{Key: "color", Value: color})
+		if dashed {
+			_ = s.SetAttribute(encoding.Attribute{Key: "style", Value: "dashed"})
+		}
+	}
+	for _, j := range d.Jobs {
+		set(ns[j.DOTID], DiffJob, false)
+	}
+	for _, c := range d.Changed {
+		if n, ok := ns[c.Element]; ok {
+			set(n, DiffChanged, false)
+		} else {
+			set(es[c.Element], DiffChanged, false)
+		}
+	}
+	for _, k := range d.AddedNodes {
+		set(ns[k], DiffAdded, false)
+	}
+	for _, k := range d.AddedEdges {
+		set(es[k], DiffAdded, false)
+	}
+	for _, k := range d.RemovedNodes {
+		set(ns[k], DiffRemoved, true)
+	}
+	for _, k := range d.RemovedEdges {
+		set(es[k], DiffRemoved, true)
+	}
+	return u
+}
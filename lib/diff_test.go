@@ -0,0 +1,124 @@
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+)
+
+const diffOld = `digraph {
+srcA [type="SRC"]; srcB [type="SRC"]; srcC [type="SRC"];
+buildA [type="JOB"]; buildB [type="JOB"]; build [type="JOB"];
+objA [type="OBJ" label="objA"]; objB [type="OBJ"]; bin [type="OBJ"];
+srcA -> buildA -> objA -> build -> bin;
+srcB -> buildB -> objB -> build;
+srcC -> build;
+}`
+
+const diffNew = `digraph {
+srcA [type="SRC"]; srcB [type="SRC"]; srcC [type="SRC"];
+buildA [type="JOB"]; buildB [type="JOB"]; buildC [type="JOB"]; build [type="JOB"];
+objA [type="OBJ" label="proto"]; objB [type="OBJ"]; objC [type="OBJ"]; bin [type="OBJ"];
+srcA -> buildA -> objA -> build -> bin;
+srcB -> buildB -> objB -> build;
+objA -> buildB [label="header"];
+srcC -> buildC -> objC -> build;
+}`
+
+func TestDiffGraphs(t *testing.T) {
+	a, b := newTestGraph(t, diffOld), newTestGraph(t, diffNew)
+	d, err := DiffGraphs(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Diff{
+		AddedNodes:   []string{"buildC", "objC"},
+		RemovedNodes: []string{},
+		AddedEdges:   []string{"buildC -> objC", "objA -> buildB", "objC -> build", "srcC -> buildC"},
+		RemovedEdges: []string{"srcC -> build"},
+		Changed: []ElementChange{
+			{Element: "objA", Attrs: []AttrChange{{Key: "label", Old: "objA", New: "proto"}}},
+		},
+		Jobs: []JobChange{
+			{DOTID: "build", Subgraph: true, OldStage: 2, NewStage: 3},
+			{DOTID: "buildB", Subgraph: true, OldStage: 1, NewStage: 2},
+		},
+	}
+	if !reflect.DeepEqual(d, e) {
+		t.Errorf("expected %+v, got %+v", e, d)
+	}
+	if s := d.Jobs[0].String(); s != "build: subgraph changed, stage 2 -> 3" {
+		t.Errorf("unexpected string %s", s)
+	}
+
+	if d, err := DiffGraphs(a, a); err != nil || !d.Empty() {
+		t.Errorf("expected no changes, got %+v (%v)", d, err)
+	}
+
+	// Nodes, edges, attributes and subgraphs are compared even if a graph has cycles
+	c := newTestGraph(t, diffNew[:len(diffNew)-1]+"bin -> srcC;\n}")
+	d2, err := DiffGraphs(a, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d2.Cyclic || !reflect.DeepEqual(d2.AddedEdges, append([]string{"bin -> srcC"}, e.AddedEdges...)) || len(d2.Changed) != 1 {
+		t.Errorf("expected the changes of the nodes and the edges, got %+v", d2)
+	}
+	for _, j := range d2.Jobs {
+		if !j.Subgraph || j.OldStage != 0 || j.NewStage != 0 {
+			t.Errorf("expected the subgraph of %s to change, without stages, got %+v", j.DOTID, j)
+		}
+	}
+
+	g := DiffGraph(a, b, d)
+	for id, c := range map[string]string{"objC": DiffAdded, "objA": DiffChanged, "buildB": DiffJob, "srcA": ""} {
+		x, _ := g.NodeByDOTID(id).(*dot.Node).Attribute("color")
+		if x != c {
+			t.Errorf("expected node %s to be colored '%s', got '%s'", id, c, x)
+		}
+	}
+	if _, es := attrMaps(g); len(es) != 12 {
+		t.Errorf("expected the union to have 12 edges, got %d", len(es))
+	} else if m := es["srcC -> build"]; m["color"] != DiffRemoved || m["style"] != "dashed" {
+		t.Errorf("expected the removed edge to be red and dashed, got %v", m)
+	}
+}
+
+func TestReadGraphFromRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=run", "-c", "user.email=run@localhost"}, args...)...)
+		cmd.Dir = dir
+		if o, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, o)
+		}
+	}
+	f := filepath.Join(dir, "graph.dot")
+	for _, s := range []string{diffOld, diffNew} {
+		if err := os.WriteFile(f, []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if s == diffOld {
+			git("init", "-q")
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", "graph")
+	}
+	a, err := ReadGraphFromRevision(dir, "HEAD~1", "graph.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NodeByDOTID("buildC") != nil || a.Nodes().Len() != 9 {
+		t.Errorf("expected the old graph, with 9 nodes, got %d", a.Nodes().Len())
+	}
+	if _, err := ReadGraphFromRevision(dir, "HEAD", "none.dot"); err == nil {
+		t.Error("expected an error for a file which does not exist")
+	}
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+var (
+	// ErrNoGraph is returned when no DOT file is provided and the default one does not exist.
+	ErrNoGraph = errors.New("no DOT file provided")
+	// ErrNodeNotFound is matched by NodeNotFoundError.
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrCycle is matched by CycleError.
+	ErrCycle = errors.New("cycle detected")
+	// ErrParse is matched by ParseError.
+	ErrParse = errors.New("parse error")
+)
+
+// NodeNotFoundError is returned when a node given by the user does not exist in a graph.
+type NodeNotFoundError struct {
+	// DOTID is the node which was not found, or the pattern which matched no node.
+	DOTID string
+	// Subgraph is the DOTID of the leaf or root of the subgraph that was searched. It is
+	// empty if the full graph was searched.
+	Subgraph string
+	// Pattern is true if DOTID is a glob or a regular expression (see ParseSelection).
+	Pattern bool
+}
+
+func (e *NodeNotFoundError) Error() string {
+	if e.Pattern {
+		if e.Subgraph == "" {
+			return fmt.Sprintf("no node matches pattern '%s'", e.DOTID)
+		}
+		return fmt.Sprintf("no node matches pattern '%s' in subgraph for '%s'", e.DOTID, e.Subgraph)
+	}
+	if e.Subgraph == "" {
+		return fmt.Sprintf("node '%s' not found", e.DOTID)
+	}
+	return fmt.Sprintf("node '%s' not found in subgraph for '%s'", e.DOTID, e.Subgraph)
+}
+
+// Is allows to match NodeNotFoundError with errors.Is(err, ErrNodeNotFound).
+func (e *NodeNotFoundError) Is(target error) bool { return target == ErrNodeNotFound }
+
+// CycleError is returned when the topological order of a graph cannot be computed.
+type CycleError struct {
+	// Cycles are the strongly connected components of the graph (see dep.Cycles).
+	Cycles []dep.Cycle
+}
+
+func (e *CycleError) Error() string {
+	cs := make([]string, 0, len(e.Cycles))
+	for _, c := range e.Cycles {
+		for _, b := range c.Back {
+			cs = append(cs, b.String())
+		}
+	}
+	return fmt.Sprintf("%s: %s", ErrCycle, strings.Join(cs, ", "))
+}
+
+// Is allows to match CycleError with errors.Is(err, ErrCycle).
+func (e *CycleError) Is(target error) bool { return target == ErrCycle }
+
+// cycleError converts the error of sorting graph 'd' into a CycleError. Other errors are
+// returned unchanged.
+func cycleError(d *dep.DependencyGraph, err error) error {
+	var u topo.Unorderable
+	if !errors.As(err, &u) {
+		return err
+	}
+	return &CycleError{Cycles: d.Cycles()}
+}
+
+// ParseError is returned when a DOT file cannot be decoded.
+type ParseError struct {
+	// File is the path of the DOT file, or empty if the source was not read from a file.
+	File string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%s: %v", ErrParse, e.Err)
+	}
+	return fmt.Sprintf("%s in '%s': %v", ErrParse, e.File, e.Err)
+}
+
+// Is allows to match ParseError with errors.Is(err, ErrParse).
+func (e *ParseError) Is(target error) bool { return target == ErrParse }
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// UnsafePathError is returned when the path of an artifact is absolute or outside of the
+// working directory. Such artifacts are not saved to the cache, and actions of the cache which
+// contain them are rejected, since they might have been crafted to overwrite arbitrary files.
+type UnsafePathError struct {
+	// Key is the key of the action in the cache, or empty if the artifact was being saved.
+	Key  string
+	Path string
+}
+
+func (e *UnsafePathError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("artifact path '%s' is not inside the working directory", e.Path)
+	}
+	return fmt.Sprintf("action %.12s of the cache: artifact path '%s' is not inside the working directory", e.Key, e.Path)
+}
@@ -3,24 +3,54 @@ package lib
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbhi/run/dep"
 )
 
 /*
-func ExecTimedCmd(dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer, verbose bool) error {
+func ExecTimedCmd(dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer, w io.Writer) error {
 	time_path, err := exec.LookPath("time")
 	if err != nil {
 		checkErr(fmt.Errorf("Please, install 'time': %s", err))
 	}
-	return ExecCmd(dir, time_path, append([]string{"-v", bin}, args...), env, cmdOut, cmdErr, verbose)
+	return ExecCmd(dir, time_path, append([]string{"-v", bin}, args...), env, cmdOut, cmdErr, w)
 }
 */
 
-func ExecCmd(dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer, verbose bool) error {
+// DefaultGracePeriod is the time that commands are given to exit after being signalled,
+// before being killed.
+const DefaultGracePeriod = 10 * time.Second
+
+// ExecCmd executes binary 'bin' with arguments 'args' in directory 'dir'. Variables 'env'
+// are appended to the environment of the process. If not nil, stdout and stderr are captured
+// in 'cmdOut' and 'cmdErr', respectively. Both of them are read concurrently, line by line,
+// and, if not nil, each line is written to 'w' as soon as it is available. Hence, lines are
+// interleaved in the same order as they are produced.
+func ExecCmd(dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer, w io.Writer) error {
+	return ExecCmdContext(context.Background(), 0, dir, bin, args, env, cmdOut, cmdErr, w)
+}
+
+// ExecCmdContext is the same as ExecCmd, but the command is executed in a new process group,
+// which is signalled when the context is done. The signal is the one received by the context
+// created with NotifyContext, or SIGTERM otherwise (e.g. a deadline was exceeded). If the
+// command does not exit within 'grace' (DefaultGracePeriod if zero), the process group is
+// killed. The error of the context is wrapped in the returned error.
+func ExecCmdContext(ctx context.Context, grace time.Duration, dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer, w io.Writer) error {
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+
 	cmd := exec.Command(bin, args...)
+	setpgid(cmd)
 
 	cmd.Env = os.Environ()
 	cmd.Env = append(cmd.Env, env...)
@@ -29,41 +59,126 @@ func ExecCmd(dir, bin string, args, env []string, cmdOut, cmdErr *bytes.Buffer,
 		cmd.Dir = dir
 	}
 
-	var teeOut, teeErr io.Reader
-	for _, v := range []struct {
-		rc  func() (io.ReadCloser, error)
-		tee *io.Reader
-		buf *bytes.Buffer
-	}{
-		{cmd.StdoutPipe, &teeOut, cmdOut},
-		{cmd.StderrPipe, &teeErr, cmdErr},
-	} {
-		r, err := v.rc()
+	rs := make([]io.Reader, 2)
+	for i, rc := range []func() (io.ReadCloser, error){cmd.StdoutPipe, cmd.StderrPipe} {
+		r, err := rc()
 		if err != nil {
 			return err
 		}
-		*v.tee = io.Reader(r)
-		if v.buf != nil {
-			*v.tee = io.TeeReader(r, v.buf)
-		}
+		rs[i] = r
 	}
 
-	done := make(chan bool)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// The errors of signalling or killing the process group are reported along with the
+	// error of the command, once the goroutine is done.
+	var sigErr error
+	exited, stopped := make(chan struct{}), make(chan struct{})
 	go func() {
-		s := bufio.NewScanner(io.MultiReader(teeOut, teeErr))
-		for s.Scan() {
-			if verbose {
-				fmt.Printf("%s\n", s.Text())
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			if err := signalGroup(cmd, contextSignal(ctx)); err != nil {
+				sigErr = fmt.Errorf("failed to signal process group of '%s': %s", bin, err)
 			}
+			select {
+			case <-exited:
+			case <-time.After(grace):
+				if err := killGroup(cmd); err != nil {
+					sigErr = fmt.Errorf("failed to kill process group of '%s': %s", bin, err)
+				}
+			}
+		case <-exited:
 		}
-		done <- true
 	}()
 
-	err := cmd.Run()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, buf := range []*bytes.Buffer{cmdOut, cmdErr} {
+		wg.Add(1)
+		go func(r *bufio.Reader, buf *bytes.Buffer) {
+			defer wg.Done()
+			for {
+				l, err := r.ReadBytes('\n')
+				if len(l) != 0 {
+					if buf != nil {
+						buf.Write(l)
+					}
+					if w != nil {
+						if l[len(l)-1] != '\n' {
+							l = append(l, '\n')
+						}
+						mu.Lock()
+						_, _ = w.Write(l)
+						mu.Unlock()
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(bufio.NewReader(rs[i]), buf)
+	}
+	wg.Wait()
+	err := cmd.Wait()
+	close(exited)
+	<-stopped
+	if err != nil && ctx.Err() != nil {
+		return &contextError{ctx: ctx.Err(), err: err, sig: sigErr}
+	}
+	if err == nil && sigErr != nil {
+		return sigErr
+	}
+	return err
+}
+
+// contextError is the error of a command which was interrupted because its context was done.
+// It matches the error of the context (with errors.Is) and it wraps the error of the command
+// (e.g. an *exec.ExitError), so that callers can check both of them. Failures to signal or
+// kill the process group are appended to the message.
+type contextError struct {
+	ctx, err, sig error
+}
+
+func (e *contextError) Error() string {
+	if e.sig != nil {
+		return fmt.Sprintf("%v (%v; %v)", e.ctx, e.err, e.sig)
+	}
+	return fmt.Sprintf("%v (%v)", e.ctx, e.err)
+}
+
+func (e *contextError) Is(target error) bool { return errors.Is(e.ctx, target) }
+
+func (e *contextError) Unwrap() error { return e.err }
+
+// Exec executes the tasks of subgraph 's', which is named 'target' (see Select). The
+// context of the tasks is retrieved from 'cfg'. See Options for the settings of the
+// execution. The results are returned even if the execution fails, or when 'ctx' is done.
+func Exec(ctx context.Context, s *dep.DependencyGraph, target string, cfg *Config, o Options) ([]*Result, error) {
+	ts, err := GetTasks(s, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	x := NewScheduler(s, ts)
+	x.Target = target
+	x.Options = o
+	return x.RunContext(ctx)
+}
 
-	<-done
-	return nil
+// Summary returns the number of results in each status, such as
+// 'succeeded: 3, failed: 1, blocked: 2'. Statuses without results are omitted.
+func Summary(rs []*Result) string {
+	c := make(map[Status]int)
+	for _, r := range rs {
+		c[r.Status]++
+	}
+	o := make([]string, 0)
+	for _, x := range []Status{Succeeded, Skipped, Cached, Planned, Failed, Cancelled, Blocked, Pending} {
+		if c[x] != 0 {
+			o = append(o, fmt.Sprintf("%s: %d", x, c[x]))
+		}
+	}
+	return strings.Join(o, ", ")
 }
@@ -0,0 +1,204 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dbhi/run/cache"
+)
+
+// resolve returns the location of path 'p', which is relative to 'dir' unless absolute.
+func resolve(dir, p string) string {
+	if dir != "" && !filepath.IsAbs(p) {
+		return filepath.Join(dir, p)
+	}
+	return p
+}
+
+// files returns the sorted list of regular files matched by the given patterns. Matched
+// directories are walked recursively. The paths are relative to 'dir', unless the pattern
+// is absolute.
+func files(dir string, ps []string) ([]string, error) {
+	m := make(map[string]bool)
+	for _, p := range ps {
+		xs, err := filepath.Glob(resolve(dir, p))
+		if err != nil {
+			return nil, fmt.Errorf("pattern '%s': %w", p, err)
+		}
+		for _, x := range xs {
+			err := filepath.WalkDir(x, func(y string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				if dir != "" && !filepath.IsAbs(p) {
+					if y, err = filepath.Rel(dir, y); err != nil {
+						return err
+					}
+				}
+				m[y] = true
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	o := make([]string, 0, len(m))
+	for k := range m {
+		o = append(o, k)
+	}
+	sort.Strings(o)
+	return o, nil
+}
+
+// fileDigest returns the digest of the content of file 'p'.
+func fileDigest(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return cache.Digest(f)
+}
+
+// Fingerprint returns a key which identifies the inputs of the task: the content of the
+// sources, the commands, the environment and the artifact patterns. Tasks with the same
+// fingerprint are expected to produce the same artifacts.
+func (t *Task) Fingerprint(dir string) (string, error) {
+	h := sha256.New()
+	for _, c := range t.Cmds {
+		fmt.Fprintf(h, "cmd %q\n", c)
+	}
+	for _, k := range sortedKeys(t.Env) {
+		fmt.Fprintf(h, "env %q=%q\n", k, t.Env[k])
+	}
+	for _, p := range sortedKeys(t.Artifacts) {
+		fmt.Fprintf(h, "artifact %q\n", p)
+	}
+	fs, err := files(dir, sortedKeys(t.Sources))
+	if err != nil {
+		return "", err
+	}
+	for _, f := range fs {
+		d, err := fileDigest(resolve(dir, f))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "source %q %s\n", f, d)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// localPath returns the location of artifact path 'p', which must be relative to 'dir' and
+// inside it. Artifact paths are read from the actions in the cache, which might be remote and
+// untrusted, so other paths (absolute or with '..') are rejected with an UnsafePathError.
+func localPath(dir, p string) (string, error) {
+	c := filepath.Clean(filepath.FromSlash(p))
+	if filepath.IsAbs(c) || filepath.VolumeName(c) != "" || c == "." || c == ".." || strings.HasPrefix(c, ".."+string(filepath.Separator)) {
+		return "", &UnsafePathError{Path: p}
+	}
+	return resolve(dir, c), nil
+}
+
+// SaveArtifacts puts the artifacts of the task in store 's', and the action under 'key'. An
+// UnsafePathError is returned if any artifact is outside 'dir', because it could not be
+// restored (see RestoreArtifacts).
+func (t *Task) SaveArtifacts(s cache.Store, key, dir string) error {
+	fs, err := files(dir, sortedKeys(t.Artifacts))
+	if err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if _, err := localPath(dir, f); err != nil {
+			return err
+		}
+	}
+	a := &cache.Action{Artifacts: make([]cache.Artifact, 0, len(fs))}
+	for _, f := range fs {
+		p := resolve(dir, f)
+		i, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		d, err := fileDigest(p)
+		if err != nil {
+			return err
+		}
+		if err := putBlob(s, d, p); err != nil {
+			return err
+		}
+		a.Artifacts = append(a.Artifacts, cache.Artifact{Path: f, Digest: d, Mode: uint32(i.Mode().Perm())})
+	}
+	return s.PutAction(key, a)
+}
+
+func putBlob(s cache.Store, d, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.PutBlob(d, f)
+}
+
+// RestoreArtifacts gets the action for 'key' from store 's' and writes the artifacts. It
+// returns false if the action or any of the blobs is not available. An UnsafePathError is
+// returned, before writing any file, if the path of any artifact is absolute or outside 'dir'.
+func (t *Task) RestoreArtifacts(s cache.Store, key, dir string) (bool, error) {
+	a, err := s.GetAction(key)
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	ps := make([]string, 0, len(a.Artifacts))
+	for _, x := range a.Artifacts {
+		p, err := localPath(dir, x.Path)
+		if err != nil {
+			return false, &UnsafePathError{Key: key, Path: x.Path}
+		}
+		ps = append(ps, p)
+	}
+	for i, x := range a.Artifacts {
+		ok, err := restoreBlob(s, x, ps[i])
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+	return true, nil
+}
+
+func restoreBlob(s cache.Store, a cache.Artifact, p string) (bool, error) {
+	r, err := s.GetBlob(a.Digest)
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer r.Close()
+	if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+		return false, err
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fs.FileMode(a.Mode))
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return false, err
+	}
+	return true, f.Close()
+}
@@ -3,9 +3,9 @@ package lib
 import (
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
 	"github.com/dbhi/run/dep"
@@ -13,9 +13,8 @@ import (
 	"gonum.org/v1/gonum/graph"
 )
 
-func ReadFile(f string) ([]byte, error) {
-	if len(f) == 0 {
-		src := `strict digraph {
+// ExampleGraph is a DOT graph which can be used as an example when no file is provided.
+const ExampleGraph = `strict digraph {
 // Node definitions.
 A [label="yellow"];
 B [label="green"];
@@ -30,11 +29,11 @@ C -> D;
 B -> F;
 B -> E;
 }`
-		fmt.Println("Empty file path! Please provide a DOT file")
-		fmt.Println("Using the following content as an example:")
-		fmt.Println(src)
-		return []byte(src), nil
-		//return nil, fmt.Errorf("Empty file path! Please provide a DOT file")
+
+// ReadFile returns the content of file 'f'. ErrNoGraph is returned if 'f' is empty.
+func ReadFile(f string) ([]byte, error) {
+	if len(f) == 0 {
+		return nil, ErrNoGraph
 	}
 	jf, err := os.Open(f)
 	if err != nil {
@@ -46,34 +45,46 @@ B -> E;
 
 func WriteGraphToFile(f string, g *dep.DependencyGraph) error {
 	if b := dot.Marshal(g); b != nil {
-		fmt.Printf("Writing graph to '%s'\n", f)
 		return os.WriteFile(f, b, 0600)
 	}
 	return fmt.Errorf("Marshal failed for file %s", f)
 }
 
+// ParseGraph decodes the DOT source 'b'. A ParseError is returned if it is not valid.
+func ParseGraph(b []byte) (*dep.DependencyGraph, error) {
+	g, err := dot.Parse(b)
+	if err != nil {
+		return nil, &ParseError{Err: err}
+	}
+	return dep.NewDependencyGraph(g), nil
+}
+
 func ReadGraphFromFile(f string) (*dep.DependencyGraph, error) {
 	b, err := ReadFile(f)
 	if err != nil {
 		return nil, err
 	}
-	g := dot.Unmarshal(b)
-	if g == nil {
-		return nil, fmt.Errorf("failed to parse input DOT file")
+	d, err := ParseGraph(b)
+	if err != nil {
+		err.(*ParseError).File = f
+		return nil, err
 	}
-	return dep.NewDependencyGraph(g), nil
+	return d, nil
 }
 
-func PrintGraph(g *dep.DependencyGraph) {
+// PrintGraph writes the nodes and the edges of 'g' to 'w', one per line.
+func PrintGraph(w io.Writer, g *dep.DependencyGraph) {
 	for _, n := range graph.NodesOf(g.Nodes()) {
-		fmt.Printf("%+v\n", n)
+		fmt.Fprintf(w, "%+v\n", n)
 	}
 	for _, e := range graph.EdgesOf(g.Edges()) {
-		fmt.Printf("%+v\n", e)
+		fmt.Fprintf(w, "%+v\n", e)
 	}
 }
 
-func InduceSubGraphsFromFile(f string) (map[string]*dep.DependencyGraph, map[string]*dep.DependencyGraph) {
+// InduceSubGraphsFromFile reads DOT file 'f' (or 'graph.dot' if empty and it exists) and
+// returns the subgraphs for each of the leafs and roots (see InduceSubGraphs).
+func InduceSubGraphsFromFile(f string) (map[string]*dep.DependencyGraph, map[string]*dep.DependencyGraph, error) {
 	if len(f) == 0 {
 		_, err := os.Stat("graph.dot")
 		if err == nil {
@@ -81,15 +92,18 @@ func InduceSubGraphsFromFile(f string) (map[string]*dep.DependencyGraph, map[str
 		}
 	}
 	d, err := ReadGraphFromFile(f)
-	checkErr(err)
-	return InduceSubGraphs(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	l, r := InduceSubGraphs(d)
+	return l, r, nil
 }
 
 func InduceSubGraphs(d *dep.DependencyGraph) (map[string]*dep.DependencyGraph, map[string]*dep.DependencyGraph) {
 	induce := func(d *dep.DependencyGraph, m map[int64]graph.Node) map[string]*dep.DependencyGraph {
 		o := make(map[string]*dep.DependencyGraph)
 		for k, n := range d.Induce(m) {
-			g := dot.Graph{n.DirectedGraph} //nolint:govet
+			g := dot.Graph{DirectedGraph: n.DirectedGraph}
 			x := g.Node(k).(*dot.Node).DOTID()
 			o[x] = n
 		}
@@ -98,31 +112,35 @@ func InduceSubGraphs(d *dep.DependencyGraph) (map[string]*dep.DependencyGraph, m
 	return induce(d, d.Leafs()), induce(d, d.Roots())
 }
 
-func Induce(f, o string, args []string) {
-	l, r := InduceSubGraphsFromFile(f)
-	if len(l) == 0 || len(r) == 0 {
-		log.Fatal("Something went wrong. Empty subgraph map!")
-	}
+// Induce writes the subgraph for each of the given nodes to directory 'o', and it returns
+// the paths of the written files. If no node is given, the subgraphs of all the leafs are
+// written.
+func Induce(l, r map[string]*dep.DependencyGraph, o string, args []string) ([]string, error) {
 	if o != "" {
-		checkErr(os.MkdirAll(o, 0644))
-	}
-	if len(args) != 0 {
-		for _, a := range args {
-			s, n := GetSubGraph(l, r, a)
-			if s == nil {
-				log.Fatal("Something went wrong. Empty subgraph!")
-			}
-			if e := WriteGraphToFile(path.Join(o, n+".dot"), s); e != nil {
-				log.Fatal(e)
-			}
+		if err := os.MkdirAll(o, 0750); err != nil {
+			return nil, err
 		}
-		return
 	}
-	for a, d := range l {
-		if e := WriteGraphToFile(path.Join(o, a+".dot"), d); e != nil {
-			log.Fatal(e)
+	fs := make([]string, 0)
+	err := eachSubGraph(l, r, args, func(n string, s *dep.DependencyGraph) error {
+		f := path.Join(o, n+".dot")
+		if err := WriteGraphToFile(f, s); err != nil {
+			return err
 		}
+		fs = append(fs, f)
+		return nil
+	})
+	return fs, err
+}
+
+// sortedGraphKeys returns the keys of a map of subgraphs in lexical order.
+func sortedGraphKeys(m map[string]*dep.DependencyGraph) []string {
+	o := make([]string, 0, len(m))
+	for k := range m {
+		o = append(o, k)
 	}
+	sort.Strings(o)
+	return o
 }
 
 /*
@@ -133,6 +151,12 @@ to the 'LEAF'. These can be either of:
 - 'DOTID>' tasks that depend on DOTID.
 - '>DOTID>' tasks that allow to build DOTID and those that depend on it.
 
+If 'TASK' is not given, the same syntax applies to 'LEAF', which can be any node (root, leaf
+or mid).
+
+Nodes in namespaces are given by the qualified DOTID (e.g. 'fpga::bin'). 'TASK' is relative
+to the namespace of 'LEAF' (see qualifyTask).
+
 it return a key for LEAF, a key for TASK, rv and fw
 */
 func parsearg(a string) (string, string, bool, bool) {
@@ -153,54 +177,110 @@ func parsearg(a string) (string, string, bool, bool) {
 	if (len(s) > 1) && (len(s[1]) > 0) {
 		t = s[1]
 		t, rv, fw = f(t)
-		return l, t, rv, fw
+		l = dot.Qualify("", l)
+		return l, qualifyTask(l, t), rv, fw
 	}
 	l, rv, fw = f(l)
-	return l, "", rv, fw
+	return dot.Qualify("", l), "", rv, fw
+}
+
+// qualifyTask returns the DOTID of task 't' in the namespace of node 'k' (see dot.Qualify).
+// Hence, in 'fpga::bin|build', the task is 'fpga::build'; tasks in other namespaces are given
+// by the qualified DOTID, and '::build' refers to the root namespace. Regular expressions are
+// not modified. In selection expressions, tasks are not qualified if the node is a pattern
+// (e.g. 'fpga::*|build'), because the namespace would be taken from the pattern.
+func qualifyTask(k, t string) string {
+	if strings.HasPrefix(t, "re:") {
+		return t
+	}
+	ns, _ := dot.SplitNamespace(k)
+	return dot.Qualify(ns, t)
 }
 
-func GetSubGraph(l, r map[string]*dep.DependencyGraph, a string) (*dep.DependencyGraph, string) {
+// GetSubGraph returns the subgraph for argument 'a' (see parsearg), along with a name for it.
+// The node can be any vertex (root, leaf or mid), and the graph is walked forward ('.fw'),
+// in reverse ('.rv') or in both directions ('.both'). Subgraphs of mid nodes are induced from
+// the union of the subgraphs of the leafs, which is the full graph. A NodeNotFoundError is
+// returned if the node or the task does not exist.
+func GetSubGraph(l, r map[string]*dep.DependencyGraph, a string) (*dep.DependencyGraph, string, error) {
 	k, t, rv, fw := parsearg(a)
+	var full *dep.DependencyGraph
+	d, err := subGraph(l, r, func() *dep.DependencyGraph {
+		if full == nil {
+			full = union(l)
+		}
+		return full
+	}, k, t, rv, fw)
+	return d, subGraphName(k, t, rv, fw), err
+}
 
+// subGraph returns the subgraph for node 'k' and the optional task 't' (see parsearg). The
+// subgraphs of the leafs ('l') and roots ('r') are used when possible; otherwise, it is
+// induced from the full graph, which is retrieved through 'full'.
+func subGraph(l, r map[string]*dep.DependencyGraph, full func() *dep.DependencyGraph, k, t string, rv, fw bool) (*dep.DependencyGraph, error) {
 	if len(t) == 0 {
-		if rv && !fw {
-			d, ok := l[k]
-			if !ok {
-				// TODO Check if it is a mid node
-				fmt.Printf("subgraph rv,!fw for node '%s' not found\n", k)
-				return nil, ""
+		switch {
+		case rv && !fw:
+			if d, ok := l[k]; ok {
+				return d, nil
 			}
-			return d, k + ".rv"
-		}
-		if !rv && fw {
-			d, ok := r[k]
-			if !ok {
-				// TODO Check if it is a mid node
-				fmt.Printf("subgraph !rv,fw for node '%s' not found\n", k)
-				return nil, ""
+		case !rv && fw:
+			if d, ok := r[k]; ok {
+				return d, nil
 			}
-			return d, k + ".fw"
-		}
-		if rv && fw {
-			fmt.Printf("mode rv,fw not implementing yet. skipping subgraph for node '%s'\n", k)
-			return nil, ""
 		}
+		return induceNode(full(), k, "", fw, rv)
 	}
 
 	d, ok := l[k]
 	if !ok {
-		// TODO Check if it is a mid node
-		fmt.Printf("subgraph rv,!fw for node '%s' not found\n", k)
-		return nil, ""
+		s, err := induceNode(full(), k, "", false, true)
+		if err != nil {
+			return nil, err
+		}
+		d = s
 	}
-	n := make(map[int64]graph.Node)
-	g := dot.Graph{d.DirectedGraph} //nolint:govet
-	x := g.GetNodeByDOTID(t)
+	return induceNode(d, t, k, fw, rv)
+}
+
+// subGraphName returns the name of the subgraph for the result of parsearg.
+func subGraphName(k, t string, rv, fw bool) string {
+	if t != "" {
+		return k + "." + t
+	}
+	switch {
+	case rv && fw:
+		return k + ".both"
+	case fw:
+		return k + ".fw"
+	}
+	return k + ".rv"
+}
+
+// induceNode returns the subgraph of 'd' for the node with DOTID 'id', walking forward ('fw'),
+// in reverse ('rv') or both. If the node is not found, a NodeNotFoundError is returned, where
+// 'sub' is the name of the subgraph that was searched.
+func induceNode(d *dep.DependencyGraph, id, sub string, fw, rv bool) (*dep.DependencyGraph, error) {
+	x := d.NodeByDOTID(id)
 	if x == nil {
-		fmt.Printf("node '%s' not found in subgraph for '%s'!\n", t, k)
-		return nil, ""
+		return nil, &NodeNotFoundError{DOTID: id, Subgraph: sub}
+	}
+	return d.InduceDir(map[int64]graph.Node{x.ID(): x}, fw, rv)[x.ID()], nil
+}
+
+// union returns a graph with all the nodes and edges of the given subgraphs. Nodes and edges
+// are shared with the subgraphs.
+func union(m map[string]*dep.DependencyGraph) *dep.DependencyGraph {
+	o := dep.NewDependencyGraph(nil)
+	for _, k := range sortedGraphKeys(m) {
+		for _, n := range graph.NodesOf(m[k].Nodes()) {
+			if o.Node(n.ID()) == nil {
+				o.AddNode(n)
+			}
+		}
+		for _, e := range graph.EdgesOf(m[k].Edges()) {
+			o.SetEdge(e)
+		}
 	}
-	n[x.ID()] = x
-	s := d.InduceDir(n, fw, rv)
-	return s[x.ID()], k + "." + t
+	return o
 }
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestGetSubGraphNotFound(t *testing.T) {
+	l, r := InduceSubGraphs(newTestGraph(t, testGraph))
+	for _, x := range []struct {
+		arg string
+		e   NodeNotFoundError
+	}{
+		{"missing", NodeNotFoundError{DOTID: "missing"}},
+		{"missing>", NodeNotFoundError{DOTID: "missing"}},
+		{"buildB|>missing", NodeNotFoundError{DOTID: "missing", Subgraph: "buildB"}},
+	} {
+		_, _, err := GetSubGraph(l, r, x.arg)
+		if !errors.Is(err, ErrNodeNotFound) {
+			t.Errorf("%s: expected ErrNodeNotFound, got %v", x.arg, err)
+			continue
+		}
+		var e *NodeNotFoundError
+		if !errors.As(err, &e) || *e != x.e {
+			t.Errorf("%s: expected %+v, got %+v", x.arg, x.e, e)
+		}
+	}
+}
+
+func TestGetTaskListCycle(t *testing.T) {
+	_, err := GetTaskList(newTestGraph(t, `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB"];
+srcA -> buildA -> srcA;
+}`))
+	if !errors.Is(err, ErrCycle) {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+	var e *CycleError
+	if !errors.As(err, &e) || len(e.Cycles) != 1 || len(e.Cycles[0].Nodes) != 2 {
+		t.Errorf("expected a single cycle of two nodes, got %v", err)
+	}
+}
+
+func TestParseGraphError(t *testing.T) {
+	_, err := ParseGraph([]byte("strict digraph {"))
+	if !errors.Is(err, ErrParse) {
+		t.Fatalf("expected ErrParse, got %v", err)
+	}
+	var e *ParseError
+	if !errors.As(err, &e) || e.Err == nil {
+		t.Errorf("expected the error of the decoder to be wrapped, got %v", err)
+	}
+	if _, err := ReadFile(""); !errors.Is(err, ErrNoGraph) {
+		t.Errorf("expected ErrNoGraph, got %v", err)
+	}
+}
+
+func TestStages(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB"];
+objA   [type="OBJ"];
+buildB [type="JOB"];
+buildC [type="JOB"];
+buildD [type="JOB"];
+srcA -> buildA -> objA -> buildB;
+objA -> buildC;
+buildB -> buildD;
+buildC -> buildD;
+}`)
+	ss, err := Stages(d, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := [][]string{{"buildA"}, {"buildB", "buildC"}, {"buildD"}}
+	if len(ss) != len(e) || len(ss[1]) != 2 || ss[0][0] != e[0][0] || ss[1][0] != e[1][0] || ss[1][1] != e[1][1] || ss[2][0] != e[2][0] {
+		t.Errorf("expected %v, got %v", e, ss)
+	}
+	if ss, _ := Stages(d, 1); len(ss) != 4 {
+		t.Errorf("expected 4 stages of width 1, got %v", ss)
+	}
+}
+
+func TestGetSubGraphExample(t *testing.T) {
+	d, err := ReadGraphFromFile("../example/graph.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, r := InduceSubGraphs(d)
+	for _, x := range []struct {
+		arg   string
+		name  string
+		nodes string
+	}{
+		// Leafs and roots
+		{"bin", "bin.rv", "bin build buildA buildB getA objA objB srcA srcB srcC"},
+		{">doc>", "doc.both", "buildDoc doc srcDoc"},
+		{"getA>", "getA.fw", "bin build buildA buildB getA objA objB srcA"},
+		{"srcB", "srcB.rv", "srcB"},
+		{"doc>", "doc.fw", "doc"},
+		// Mid nodes
+		{"objA", "objA.rv", "buildA getA objA srcA"},
+		{">objA", "objA.rv", "buildA getA objA srcA"},
+		{"objA>", "objA.fw", "bin build buildB objA objB"},
+		{">objA>", "objA.both", "bin build buildA buildB getA objA objB srcA"},
+		// Tasks in the subgraph of a leaf or a mid node
+		{"bin|>objB", "bin.objB", "buildA buildB getA objA objB srcA srcB"},
+		{"bin|buildB>", "bin.buildB", "bin build buildB objB"},
+		{"bin|>buildB>", "bin.buildB", "bin build buildA buildB getA objA objB srcA srcB"},
+		{"objB|buildA>", "objB.buildA", "buildA buildB objA objB"},
+	} {
+		s, n, err := GetSubGraph(l, r, x.arg)
+		if err != nil {
+			t.Errorf("%s: %v", x.arg, err)
+			continue
+		}
+		ns := make([]string, 0)
+		for _, v := range graph.NodesOf(s.Nodes()) {
+			ns = append(ns, v.(*dot.Node).DOTID())
+		}
+		sort.Strings(ns)
+		if n != x.name || strings.Join(ns, " ") != x.nodes {
+			t.Errorf("%s: expected %s with nodes [%s], got %s with [%s]", x.arg, x.name, x.nodes, n, strings.Join(ns, " "))
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// Conflict is an attribute of a node or an edge which has different values in the merged
+// graphs. The first value is the one kept in the result of Merge.
+type Conflict struct {
+	// Element is the DOTID of the node, or 'FROM -> TO' for edges.
+	Element string
+	Key     string
+	// Values are the different values of the attribute, in the order they were found.
+	Values []string
+	// Sources identify the graph where each of the values was found: the index of the graph
+	// (see Merge) or the name of the file (see ReadGraphsFromFiles).
+	Sources []string
+}
+
+// String returns the conflict as 'objA: type="OBJ" (hw.dot), type="SRC" (sw.dot)'.
+func (c Conflict) String() string {
+	o := make([]string, 0, len(c.Values))
+	for i, v := range c.Values {
+		o = append(o, fmt.Sprintf("%s=%q (%s)", c.Key, v, c.Sources[i]))
+	}
+	return c.Element + ": " + strings.Join(o, ", ")
+}
+
+// merger accumulates the nodes and edges of several graphs, unified by DOTID.
+type merger struct {
+	g   dot.Graph
+	ids map[string]*dot.Node
+	// origin is the source of the value of each attribute, where the key is 'element|key'
+	origin    map[string]string
+	conflicts map[string]*Conflict
+	order     []string
+}
+
+func newMerger() *merger {
+	return &merger{
+		g:         dot.Graph{DirectedGraph: simple.NewDirectedGraph()},
+		ids:       make(map[string]*dot.Node),
+		origin:    make(map[string]string),
+		conflicts: make(map[string]*Conflict),
+	}
+}
+
+// attrs merges attributes 'as' of element 'id' in graph 'src' into 'dst'. Values which differ
+// from the ones already set are recorded as conflicts.
+func (m *merger) attrs(id string, dst encoding.Attributer, as []encoding.Attribute, src string) {
+	sort.Slice(as, func(i, j int) bool { return as[i].Key < as[j].Key })
+	cur := make(map[string]string)
+	for _, a := range dst.Attributes() {
+		cur[a.Key] = a.Value
+	}
+	for _, a := range as {
+		k := id + "|" + a.Key
+		v, ok := cur[a.Key]
+		if !ok {
+			// Both dot.Node and the edges created by dot.Graph are AttributeSetters
+			_ = dst.(encoding.AttributeSetter).SetAttribute(a)
+			m.origin[k] = src
+			continue
+		}
+		if v == a.Value {
+			continue
+		}
+		c, ok := m.conflicts[k]
+		if !ok {
+			c = &Conflict{Element: id, Key: a.Key, Values: []string{v}, Sources: []string{m.origin[k]}}
+			m.conflicts[k] = c
+			m.order = append(m.order, k)
+		}
+		found := false
+		for _, x := range c.Values {
+			found = found || x == a.Value
+		}
+		if !found {
+			c.Values = append(c.Values, a.Value)
+			c.Sources = append(c.Sources, src)
+		}
+	}
+}
+
+// node returns the node of the result with the given DOTID, which is created if needed.
+func (m *merger) node(id string) *dot.Node {
+	y, ok := m.ids[id]
+	if !ok {
+		y = m.g.NewNode().(*dot.Node)
+		y.SetDOTID(id)
+		m.g.AddNode(y)
+		m.ids[id] = y
+	}
+	return y
+}
+
+// add merges graph 'd', identified by 'src', into the result. The DOTIDs of the nodes are
+// prefixed with namespace 'ns', if not empty.
+func (m *merger) add(d *dep.DependencyGraph, src, ns string) {
+	id := func(n graph.Node) string {
+		if ns == "" {
+			return n.(*dot.Node).DOTID()
+		}
+		return ns + dot.NamespaceSep + n.(*dot.Node).DOTID()
+	}
+	nodes := graph.NodesOf(d.Nodes())
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	for _, n := range nodes {
+		m.attrs(id(n), m.node(id(n)), n.(*dot.Node).Attributes(), src)
+	}
+	es := graph.EdgesOf(d.Edges())
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].From().ID() != es[j].From().ID() {
+			return es[i].From().ID() < es[j].From().ID()
+		}
+		return es[i].To().ID() < es[j].To().ID()
+	})
+	for _, e := range es {
+		var as []encoding.Attribute
+		if a, ok := e.(encoding.Attributer); ok {
+			as = a.Attributes()
+		}
+		m.edge(m.ids[id(e.From())], m.ids[id(e.To())], as, src)
+	}
+}
+
+// edge adds an edge between nodes 'u' and 'v' of the result, unless it exists, and it merges
+// attributes 'as' of graph 'src'.
+func (m *merger) edge(u, v *dot.Node, as []encoding.Attribute, src string) {
+	x := m.g.Edge(u.ID(), v.ID())
+	if x == nil {
+		x = m.g.NewEdge(u, v)
+		m.g.SetEdge(x)
+	}
+	m.attrs(u.DOTID()+" -> "+v.DOTID(), x.(encoding.Attributer), as, src)
+}
+
+// result returns the merged graph, along with the conflicts in the order they were found.
+func (m *merger) result() (*dep.DependencyGraph, []Conflict) {
+	o := make([]Conflict, 0, len(m.order))
+	for _, k := range m.order {
+		o = append(o, *m.conflicts[k])
+	}
+	return dep.NewDependencyGraph(m.g.DirectedGraph), o
+}
+
+// Merge returns a graph which contains the nodes and edges of all the given graphs. Nodes
+// are unified by DOTID, and edges between the same pair of nodes are deduplicated. Attributes
+// are combined; when a node or an edge has different values for the same attribute, the first
+// one is kept and a Conflict is reported, where the sources are the indexes of the graphs.
+//
+// Complexity: O(G*(V+E)) where G is the number of graphs
+func Merge(ds ...*dep.DependencyGraph) (*dep.DependencyGraph, []Conflict) {
+	m := newMerger()
+	for i, d := range ds {
+		m.add(d, strconv.Itoa(i), "")
+	}
+	return m.result()
+}
+
+// namespaceRe matches the namespaces which can be given in 'NS=FILE' arguments: identifiers,
+// optionally nested (e.g. 'soc::fpga').
+var namespaceRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(::[A-Za-z_][A-Za-z0-9_-]*)*$`)
+
+// splitNamespace returns the namespace and the path of a file given as 'NS=FILE'. The text
+// before the first '=' is a namespace only if it is a valid one (see namespaceRe); otherwise,
+// the namespace is empty and 'f' is the path (e.g. 'out/a=b.dot').
+func splitNamespace(f string) (string, string) {
+	if i := strings.Index(f, "="); i >= 0 && namespaceRe.MatchString(f[:i]) {
+		return f[:i], f[i+1:]
+	}
+	return "", f
+}
+
+// ReadGraphsFromFiles reads and merges the given DOT files (see Merge), and it adds edges
+// 'es' (see Config.Edges). Files given as 'NS=FILE', where NS is an identifier (optionally
+// nested, such as 'soc::fpga'), are imported in namespace NS; i.e. the DOTIDs of the nodes are
+// prefixed with 'NS::' (see dot.NamespaceSep), so that they do not collide with the nodes of
+// other files. The sources of the conflicts are the files, as given. A NodeNotFoundError is
+// returned if an edge refers to a node which does not exist. If a single file is given,
+// without namespace or edges, it is returned as is.
+func ReadGraphsFromFiles(fs []string, es []Edge) (*dep.DependencyGraph, []Conflict, error) {
+	if len(fs) == 0 {
+		d, err := ReadGraphFromFile("")
+		return d, nil, err
+	}
+	if ns, p := splitNamespace(fs[0]); len(fs) == 1 && len(es) == 0 && ns == "" {
+		d, err := ReadGraphFromFile(p)
+		return d, nil, err
+	}
+	m := newMerger()
+	for _, f := range fs {
+		ns, p := splitNamespace(f)
+		d, err := ReadGraphFromFile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		m.add(d, f, ns)
+	}
+	for _, e := range es {
+		var ns [2]*dot.Node
+		for i, id := range []string{e.From, e.To} {
+			n, ok := m.ids[dot.Qualify("", id)]
+			if !ok {
+				return nil, nil, &NodeNotFoundError{DOTID: id}
+			}
+			ns[i] = n
+		}
+		if ns[0] == ns[1] {
+			return nil, nil, fmt.Errorf("edge from '%s' to itself", e.From)
+		}
+		as := make([]encoding.Attribute, 0, len(e.Attrs))
+		for k, v := range e.Attrs {
+			as = append(as, encoding.Attribute{Key: k, Value: v})
+		}
+		m.edge(ns[0], ns[1], as, "edges")
+	}
+	d, cs := m.result()
+	return d, cs, nil
+}
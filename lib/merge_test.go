@@ -0,0 +1,163 @@
+package lib
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestMerge(t *testing.T) {
+	hw := newTestGraph(t, `digraph {
+srcHW [type="SRC"];
+bit   [type="OBJ" label="bitstream"];
+srcHW -> synth -> bit;
+bit -> pack [label="hw"];
+}`)
+	sw := newTestGraph(t, `digraph {
+srcSW [type="SRC"];
+bit   [type="ART" label="bitstream"];
+srcSW -> compile -> elf -> pack;
+bit -> pack [label="sw"];
+pack -> image;
+}`)
+	doc := newTestGraph(t, `digraph {
+bit [type="DOC"];
+bit -> pack;
+}`)
+
+	d, cs := Merge(hw, sw, doc)
+	ns := make([]string, 0)
+	for _, n := range graph.NodesOf(d.Nodes()) {
+		ns = append(ns, n.(*dot.Node).DOTID())
+	}
+	if e := 8; len(ns) != e {
+		t.Errorf("expected %d nodes, got %v", e, ns)
+	}
+	if e := 7; d.Edges().Len() != e {
+		t.Errorf("expected %d edges, got %d", e, d.Edges().Len())
+	}
+	if l, err := GetTaskList(d); err != nil || strings.Join(l, " ") != "" {
+		t.Errorf("unexpected task list %v (%v)", l, err)
+	}
+
+	bit := d.NodeByDOTID("bit").(*dot.Node)
+	if x, _ := bit.Attribute("type"); x != "OBJ" {
+		t.Errorf("expected the first value of 'type' to be kept, got '%s'", x)
+	}
+	e := []Conflict{
+		{Element: "bit", Key: "type", Values: []string{"OBJ", "ART", "DOC"}, Sources: []string{"0", "1", "2"}},
+		{Element: "bit -> pack", Key: "label", Values: []string{"hw", "sw"}, Sources: []string{"0", "1"}},
+	}
+	if !reflect.DeepEqual(cs, e) {
+		t.Errorf("expected conflicts %v, got %v", e, cs)
+	}
+	if s := cs[1].String(); s != `bit -> pack: label="hw" (0), label="sw" (1)` {
+		t.Errorf("unexpected string %s", s)
+	}
+}
+
+func TestReadGraphsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	fs := []string{filepath.Join(dir, "a.dot"), filepath.Join(dir, "b.dot")}
+	for i, s := range []string{
+		`digraph { x [type="JOB"]; shared [type="OBJ"]; a -> x -> shared; }`,
+		`digraph { shared [type="SRC"]; shared -> y; }`,
+	} {
+		if err := os.WriteFile(fs[i], []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, cs, err := ReadGraphsFromFiles(fs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Nodes().Len() != 4 || d.Edges().Len() != 3 {
+		t.Errorf("expected 4 nodes and 3 edges, got %d and %d", d.Nodes().Len(), d.Edges().Len())
+	}
+	if len(cs) != 1 || !reflect.DeepEqual(cs[0].Sources, fs) {
+		t.Errorf("expected a conflict between the files, got %v", cs)
+	}
+}
+
+func TestReadGraphsFromFilesNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	for n, s := range map[string]string{
+		"main.dot": `digraph { src -> build -> image; build [type="JOB"]; }`,
+		"fpga.dot": `digraph { src -> build -> bit; build [type="JOB"]; }`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, n), []byte(s), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := []string{filepath.Join(dir, "main.dot"), "fpga=" + filepath.Join(dir, "fpga.dot")}
+	es := []Edge{{From: "fpga::bit", To: "::build", Attrs: map[string]string{"label": "bitstream"}}}
+	d, cs, err := ReadGraphsFromFiles(fs, es)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 0 || d.Nodes().Len() != 6 || d.Edges().Len() != 5 {
+		t.Fatalf("expected 6 nodes, 5 edges and no conflicts, got %d, %d and %v", d.Nodes().Len(), d.Edges().Len(), cs)
+	}
+	if n := d.NodeByDOTID("fpga::build"); n == nil || n.(*dot.Node).Namespace() != "fpga" {
+		t.Errorf("expected node 'fpga::build' in namespace 'fpga', got %v", n)
+	}
+
+	l, r := InduceSubGraphs(d)
+	for _, x := range []struct {
+		arg, tasks string
+	}{
+		{"image", "fpga::build build"},
+		{"fpga::bit", "fpga::build"},
+		{"image|fpga::build>", "fpga::build build"},
+		{"fpga::bit|build", "fpga::build"},
+		{"image|::build", "fpga::build build"},
+		{"ns=fpga", "fpga::build"},
+		{"ns=:: & type=JOB", "build"},
+	} {
+		ls, err := List(l, r, []string{x.arg})
+		if err != nil {
+			t.Errorf("%s: %v", x.arg, err)
+			continue
+		}
+		if s := strings.Join(ls[0].Tasks, " "); s != x.tasks {
+			t.Errorf("%s: expected [%s], got [%s]", x.arg, x.tasks, s)
+		}
+	}
+
+	b := dot.Marshal(d)
+	if !strings.Contains(string(b), "subgraph cluster_fpga {") {
+		t.Errorf("expected a cluster for namespace 'fpga', got:\n%s", b)
+	}
+	p, err := ParseGraph(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Nodes().Len() != 6 || p.Edges().Len() != 5 {
+		t.Errorf("expected the marshalled graph to have 6 nodes and 5 edges, got %d and %d", p.Nodes().Len(), p.Edges().Len())
+	}
+
+	if _, _, err := ReadGraphsFromFiles(fs, []Edge{{From: "bit", To: "build"}}); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("expected ErrNodeNotFound, got %v", err)
+	}
+}
+
+func TestSplitNamespace(t *testing.T) {
+	for _, x := range []struct{ arg, ns, file string }{
+		{"graph.dot", "", "graph.dot"},
+		{"fpga=fpga/graph.dot", "fpga", "fpga/graph.dot"},
+		{"soc::fpga=graph.dot", "soc::fpga", "graph.dot"},
+		{"out/a=b.dot", "", "out/a=b.dot"},
+		{"a.b=c.dot", "", "a.b=c.dot"},
+		{"=graph.dot", "", "=graph.dot"},
+	} {
+		if ns, f := splitNamespace(x.arg); ns != x.ns || f != x.file {
+			t.Errorf("%s: expected '%s' and '%s', got '%s' and '%s'", x.arg, x.ns, x.file, ns, f)
+		}
+	}
+}
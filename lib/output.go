@@ -0,0 +1,75 @@
+package lib
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sync"
+
+	au "github.com/logrusorgru/aurora"
+)
+
+// Output is the mode to show the output of the tasks which are executed concurrently.
+type Output string
+
+const (
+	// Interleaved shows the lines as soon as they are produced by any of the tasks.
+	Interleaved Output = "interleaved"
+	// Group buffers the output of each task, and shows it at once when the task ends.
+	Group Output = "group"
+	// Prefixed shows the lines as soon as they are produced, each of them tagged with the
+	// DOTID of the task (e.g. '[buildA] ').
+	Prefixed Output = "prefixed"
+)
+
+// ParseOutput returns the Output for the given name.
+func ParseOutput(s string) (Output, error) {
+	switch o := Output(s); o {
+	case Interleaved, Group, Prefixed:
+		return o, nil
+	case "":
+		return Interleaved, nil
+	}
+	return "", fmt.Errorf("unknown output mode '%s' (use '%s', '%s' or '%s')", s, Interleaved, Group, Prefixed)
+}
+
+// syncWriter serialises the writes to 'w', so that writes from different tasks are not mixed.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+// prefixWriter adds a prefix to each write, which is expected to be a complete line (see
+// ExecCmd).
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+}
+
+func (p prefixWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(append([]byte(p.prefix), b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// prefixColors are the colors used for the prefixes of the tasks.
+var prefixColors = []au.Color{au.GreenFg, au.YellowFg, au.BlueFg, au.MagentaFg, au.CyanFg, au.RedFg}
+
+// prefix returns the prefix for the lines of task 't'. If 'color' is set, a color is picked
+// from the DOTID of the task, so that it is consistent between runs.
+func prefix(t string, color bool) string {
+	p := "[" + t + "]"
+	if color {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(t))
+		return au.Colorize(p, prefixColors[h.Sum32()%uint32(len(prefixColors))]).String() + " "
+	}
+	return p + " "
+}
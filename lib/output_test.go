@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSchedulerRunOutput(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	cmds := map[string]string{
+		"buildA": "echo A1; sleep 0.05; echo A2 >&2",
+		"buildB": "echo B1",
+		"buildC": "echo C1; sleep 0.1; echo C2",
+	}
+	for _, x := range []struct {
+		mode  Output
+		check func(string) bool
+	}{
+		// The order between the lines of concurrent tasks depends on the timing, so only the
+		// integrity of each line is checked
+		{Interleaved, func(o string) bool {
+			ls := strings.Split(strings.TrimSuffix(o, "\n"), "\n")
+			sort.Strings(ls)
+			return strings.Join(ls, " ") == "A1 A2 B1 C1 C2"
+		}},
+		{Group, func(o string) bool {
+			return strings.Contains(o, "A1\nA2\n") && strings.Contains(o, "C1\nC2\n")
+		}},
+		{Prefixed, func(o string) bool {
+			return strings.Contains(o, "[buildA] A2\n") && strings.Contains(o, "[buildB] B1\n") && strings.Contains(o, "[buildC] C1\n")
+		}},
+	} {
+		var b bytes.Buffer
+		s := NewScheduler(d, testTasks(t, d, cmds))
+		s.Jobs = 2
+		s.Verbose = true
+		s.Output = x.mode
+		s.Writer = &b
+		rs, err := s.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if o := b.String(); !x.check(o) {
+			t.Errorf("%s: unexpected output %q", x.mode, o)
+		}
+		for _, r := range rs {
+			if r.Task.DOTID == "buildA" && (r.Stdout.String() != "A1\n" || r.Stderr.String() != "A2\n") {
+				t.Errorf("%s: unexpected captured output %q %q", x.mode, r.Stdout.String(), r.Stderr.String())
+			}
+		}
+	}
+}
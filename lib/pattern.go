@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+// pattern selects nodes by name. Literal patterns match the DOTID exactly. Shell globs (see
+// path.Match) and regular expressions (prefixed with 're:') match the DOTID or the label.
+// Names prefixed with 'id:' are literal, even if they contain glob characters ('id:a[1]').
+type pattern struct {
+	text    string
+	re      *regexp.Regexp
+	literal bool
+}
+
+// isPattern returns true if 's' is a glob or a regular expression, rather than a DOTID.
+func isPattern(s string) bool {
+	return strings.HasPrefix(s, "re:") || strings.ContainsAny(s, "*?[")
+}
+
+// newPattern returns the pattern for name 's', which is qualified in namespace 'ns' (see
+// dot.Qualify), unless it is a regular expression.
+func newPattern(ns, s string) (pattern, error) {
+	if strings.HasPrefix(s, "id:") {
+		return pattern{text: dot.Qualify(ns, s[3:]), literal: true}, nil
+	}
+	if strings.HasPrefix(s, "re:") {
+		re, err := regexp.Compile(s[3:])
+		if err != nil {
+			return pattern{}, fmt.Errorf("invalid regular expression '%s': %w", s[3:], err)
+		}
+		return pattern{text: s, re: re}, nil
+	}
+	s = dot.Qualify(ns, s)
+	if isPattern(s) {
+		if _, err := path.Match(s, ""); err != nil {
+			return pattern{}, fmt.Errorf("invalid glob '%s': %w", s, err)
+		}
+	}
+	return pattern{text: s}, nil
+}
+
+// isPattern returns true if the pattern is a glob or a regular expression.
+func (p pattern) isPattern() bool {
+	return !p.literal && isPattern(p.text)
+}
+
+func (p pattern) matchString(s string) bool {
+	if p.re != nil {
+		return p.re.MatchString(s)
+	}
+	ok, _ := path.Match(p.text, s)
+	return ok
+}
+
+// match returns true if the DOTID or the label of node 'n' is matched by the pattern.
+func (p pattern) match(n *dot.Node) bool {
+	if p.matchString(n.DOTID()) {
+		return true
+	}
+	l, err := n.Attribute("label")
+	return err == nil && p.matchString(l)
+}
+
+// nodes returns the DOTIDs of the nodes of 'd' which are matched by the pattern, sorted by
+// ID. Literal patterns are looked up in the index of DOTIDs (see dep.NodeByDOTID).
+func (p pattern) nodes(d *dep.DependencyGraph) []string {
+	if !p.isPattern() {
+		if d.NodeByDOTID(p.text) != nil {
+			return []string{p.text}
+		}
+		return nil
+	}
+	ns := graph.NodesOf(d.Nodes())
+	sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+	o := make([]string, 0)
+	for _, n := range ns {
+		if x := n.(*dot.Node); p.match(x) {
+			o = append(o, x.DOTID())
+		}
+	}
+	return o
+}
@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setpgid makes the command to be executed in a new process group, so that signals can be
+// sent to all of its children (e.g. 'make -j' workers).
+func setpgid(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalGroup sends signal 's' to the process group of the command.
+func signalGroup(cmd *exec.Cmd, s os.Signal) error {
+	x, ok := s.(syscall.Signal)
+	if !ok {
+		x = syscall.SIGTERM
+	}
+	return ignoreESRCH(syscall.Kill(-cmd.Process.Pid, x))
+}
+
+// killGroup kills all the processes in the process group of the command.
+func killGroup(cmd *exec.Cmd) error {
+	return ignoreESRCH(syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL))
+}
+
+// ignoreESRCH returns nil if the process group does not exist anymore.
+func ignoreESRCH(err error) error {
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+//go:build windows
+// +build windows
+
+package lib
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setpgid is a no-op on Windows, where process groups are not supported.
+func setpgid(cmd *exec.Cmd) {}
+
+// signalGroup kills the process of the command, since sending signals is not supported on
+// Windows.
+func signalGroup(cmd *exec.Cmd, s os.Signal) error {
+	return cmd.Process.Kill()
+}
+
+// killGroup kills the process of the command.
+func killGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
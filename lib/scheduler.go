@@ -0,0 +1,490 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dbhi/run/cache"
+	"github.com/dbhi/run/dep"
+	"gonum.org/v1/gonum/graph"
+)
+
+// Status is the execution state of a task.
+type Status int
+
+const (
+	// Pending tasks were not executed.
+	Pending Status = iota
+	// Succeeded tasks were executed and all of their commands exited with code zero.
+	Succeeded
+	// Failed tasks were executed and one of their commands failed.
+	Failed
+	// Skipped tasks were not executed because they were up to date.
+	Skipped
+	// Cached tasks were not executed because their artifacts were restored from a cache.
+	Cached
+	// Planned tasks would be executed, but dry-run mode was enabled.
+	Planned
+	// Blocked tasks were not executed because one of their predecessors failed.
+	Blocked
+	// Cancelled tasks were interrupted before finishing (e.g. a signal was received or a
+	// sibling failed).
+	Cancelled
+)
+
+func (s Status) String() string {
+	switch s {
+	case Pending:
+		return "pending"
+	case Succeeded:
+		return "succeeded"
+	case Failed:
+		return "failed"
+	case Skipped:
+		return "skipped"
+	case Cached:
+		return "cached"
+	case Planned:
+		return "planned"
+	case Blocked:
+		return "blocked"
+	case Cancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Result is the outcome of executing a task.
+type Result struct {
+	Task     *Task
+	Status   Status
+	Duration time.Duration
+	ExitCode int
+	// Reason explains why the task was executed or skipped.
+	Reason string
+	// Fingerprint identifies the inputs of the task (see Task.Fingerprint).
+	Fingerprint string
+	// Attempts are the executions of the task, including retries.
+	Attempts []Attempt
+	// Warnings are problems which did not make the task fail, such as failing to save the
+	// artifacts to the cache.
+	Warnings []string
+	Stdout   bytes.Buffer
+	Stderr   bytes.Buffer
+	Err      error
+}
+
+// Attempt is the outcome of one execution of a task.
+type Attempt struct {
+	Duration time.Duration
+	ExitCode int
+	Err      error
+}
+
+// Scheduler executes the tasks of a dependency graph concurrently. Each task is sent to a
+// worker as soon as all of its predecessors succeeded. Nodes which are not tasks (e.g.
+// sources or artifacts) are considered to be done as soon as their predecessors are. When
+// a task fails, all the tasks which depend on it are blocked, unless failures are allowed
+// for the task (see Task.AllowFailure).
+type Scheduler struct {
+	Graph *dep.DependencyGraph
+	Tasks []*Task
+	// Target is the name of the subgraph, used for the state file.
+	Target string
+	Options
+	// previous is the state of the last run, when resuming.
+	previous *State
+	// out serialises the writes to Writer.
+	out *syncWriter
+}
+
+// Options are the settings of a Scheduler.
+type Options struct {
+	// Jobs is the maximum number of tasks executed concurrently. If lower than one,
+	// 'runtime.NumCPU()' is used.
+	Jobs int
+	// Dir is the working directory of the commands.
+	Dir string
+	// Verbose enables printing the output of the commands.
+	Verbose bool
+	// Output is the mode to show the output of the commands, when Verbose is set.
+	Output Output
+	// Color enables coloring the prefixes in Prefixed output mode.
+	Color bool
+	// Writer is where the output of the commands is written to. If nil, os.Stdout is used.
+	Writer io.Writer
+	// GracePeriod is the time that tasks are given to exit after being signalled, before
+	// being killed. If zero, DefaultGracePeriod is used.
+	GracePeriod time.Duration
+	// Force disables the up-to-date checks and restoring artifacts from the cache, so that
+	// all the tasks are executed.
+	Force bool
+	// Cache is the store where the artifacts of the tasks are saved and restored from.
+	// If nil, caching is disabled.
+	Cache cache.Store
+	// KeepGoing enables executing the tasks which do not depend on failed ones. By default,
+	// no new tasks are started after a failure, and those being executed are cancelled
+	// (fail fast).
+	KeepGoing bool
+	// StateDir is the directory where a journal of the run is saved, with the state of each
+	// task (see State). If empty, no journal is saved.
+	StateDir string
+	// Resume enables skipping the tasks which succeeded in the last run (as saved in the
+	// journal), as long as their inputs did not change.
+	Resume bool
+	// DryRun disables the execution of the tasks and restoring artifacts from the cache.
+	// Up-to-date checks are evaluated, and tasks which would be executed are 'Planned', along
+	// with all the tasks which depend on them.
+	DryRun bool
+}
+
+// NewScheduler returns a Scheduler for the tasks of the dependency graph 'd'.
+func NewScheduler(d *dep.DependencyGraph, ts []*Task) *Scheduler {
+	return &Scheduler{Graph: d, Tasks: ts}
+}
+
+// Run executes the tasks with RunContext and a background context.
+func (s *Scheduler) Run() ([]*Result, error) {
+	return s.RunContext(context.Background())
+}
+
+// RunContext executes the tasks and returns a result for each of them, in the same order as
+// 'Tasks'. Once a task fails, no new tasks are started and those being executed are
+// cancelled; unless 'KeepGoing' is set. When the context is done, no new tasks are started
+// and those being executed are cancelled. A non-nil error is returned if any task failed,
+// excluding those with allowed failures, if the context is done, or if the journal could not
+// be saved. Notices about retries are written to 'Writer', and other problems which do not
+// make a task fail are reported in the Warnings of the results.
+func (s *Scheduler) RunContext(ctx context.Context) ([]*Result, error) {
+	ns, err := s.Graph.Sort()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := s.Jobs
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	if s.Writer != nil {
+		s.out = &syncWriter{w: s.Writer}
+	} else {
+		s.out = &syncWriter{w: os.Stdout}
+	}
+
+	rs := make([]*Result, len(s.Tasks))
+	tm := make(map[int64]*Result, len(s.Tasks))
+	for i, t := range s.Tasks {
+		rs[i] = &Result{Task: t}
+		tm[t.ID] = rs[i]
+	}
+
+	journal := func(*Result) error { return nil }
+	if s.StateDir != "" {
+		f := StateFile(s.StateDir, s.Target)
+		if s.Resume {
+			if s.previous, err = ReadState(f); err != nil {
+				return nil, err
+			}
+		}
+		if !s.DryRun {
+			st := &State{Target: s.Target, Tasks: make(map[string]TaskState, len(rs))}
+			for _, r := range rs {
+				st.update(r)
+			}
+			journal = func(r *Result) error {
+				if r != nil {
+					st.update(r)
+				}
+				return st.Write(f)
+			}
+		}
+	}
+	if err := journal(nil); err != nil {
+		return nil, err
+	}
+
+	// Number of predecessors of each node which are not done yet.
+	deps := make(map[int64]int, len(ns))
+	ready := make([]graph.Node, 0)
+	for _, n := range ns {
+		deps[n.ID()] = s.Graph.To(n.ID()).Len()
+		if deps[n.ID()] == 0 {
+			ready = append(ready, n)
+		}
+	}
+	release := func(id int64) {
+		for _, n := range graph.NodesOf(s.Graph.From(id)) {
+			deps[n.ID()]--
+			if deps[n.ID()] == 0 {
+				ready = append(ready, n)
+			}
+		}
+	}
+	var block func(id int64)
+	block = func(id int64) {
+		for _, n := range graph.NodesOf(s.Graph.From(id)) {
+			if r, ok := tm[n.ID()]; ok {
+				if r.Status == Blocked {
+					continue
+				}
+				r.Status = Blocked
+			}
+			block(n.ID())
+		}
+	}
+
+	// In dry-run mode, the tasks which depend on a planned one would be executed too, because
+	// their sources would be rebuilt, even if they are up to date now.
+	rebuilt := make(map[int64]bool)
+	plan := func(id int64) {
+		for k := range s.Graph.Descendants(id) {
+			rebuilt[k] = true
+		}
+	}
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan *Result, jobs)
+	done := make(chan *Result)
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for r := range work {
+				s.exec(wctx, r)
+				done <- r
+			}
+		}()
+	}
+
+	// Failing to update the journal does not stop the run, but the first error is returned.
+	var stateErr error
+	save := func(r *Result) {
+		if err := journal(r); err != nil && stateErr == nil {
+			stateErr = fmt.Errorf("failed to save state: %w", err)
+		}
+	}
+
+	running, failed := 0, 0
+	for {
+		for wctx.Err() == nil && (failed == 0 || s.KeepGoing) && running < jobs && len(ready) > 0 {
+			n := ready[0]
+			ready = ready[1:]
+			r, ok := tm[n.ID()]
+			if !ok {
+				release(n.ID())
+				continue
+			}
+			if s.DryRun && rebuilt[n.ID()] {
+				r.Status, r.Reason = Planned, "a dependency would be rebuilt"
+				plan(n.ID())
+				release(n.ID())
+				continue
+			}
+			running++
+			work <- r
+		}
+		if running == 0 {
+			break
+		}
+		r := <-done
+		running--
+		save(r)
+		if r.Status == Cancelled {
+			block(r.Task.ID)
+			continue
+		}
+		if r.Status == Planned {
+			plan(r.Task.ID)
+		}
+		if r.Status == Failed && !r.Task.AllowFailure {
+			failed++
+			block(r.Task.ID)
+			if !s.KeepGoing {
+				cancel()
+			}
+			continue
+		}
+		release(r.Task.ID)
+	}
+	close(work)
+
+	for _, r := range rs {
+		if r.Status == Blocked {
+			save(r)
+		}
+	}
+
+	if failed != 0 {
+		if stateErr != nil {
+			return rs, fmt.Errorf("%d task(s) failed; %s", failed, stateErr)
+		}
+		return rs, fmt.Errorf("%d task(s) failed", failed)
+	}
+	if err := ctx.Err(); err != nil {
+		return rs, err
+	}
+	return rs, stateErr
+}
+
+// exec executes the task of a result and fills the remaining fields. Unless 'Force' is set,
+// the task is skipped if it is up to date, or if its artifacts are restored from the cache.
+func (s *Scheduler) exec(ctx context.Context, r *Result) {
+	fail := func(err error) {
+		r.Status, r.ExitCode, r.Err = Failed, -1, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		r.Status, r.Reason, r.Err = Cancelled, "not started", err
+		return
+	}
+
+	var key string
+	if s.Cache != nil || s.StateDir != "" {
+		k, err := r.Task.Fingerprint(s.Dir)
+		if err != nil {
+			fail(err)
+			return
+		}
+		r.Fingerprint = k
+		if s.Cache != nil {
+			key = k
+		}
+	}
+
+	if s.Resume && !s.Force && s.previous.done(r.Task.DOTID, r.Fingerprint) {
+		r.Status, r.Reason = Skipped, "succeeded in the last run and inputs did not change"
+		return
+	}
+
+	if s.Force {
+		r.Reason = "forced"
+	} else {
+		ok, why, err := r.Task.UpToDate(s.Dir)
+		if err != nil {
+			fail(err)
+			return
+		}
+		r.Reason = why
+		if ok {
+			r.Status = Skipped
+			return
+		}
+		if key != "" && len(r.Task.Artifacts) != 0 && s.DryRun {
+			if _, err := cache.LookupAction(s.Cache, key); err == nil {
+				r.Reason = fmt.Sprintf("would be restored from cache (%.12s)", key)
+			}
+		}
+		if key != "" && len(r.Task.Artifacts) != 0 && !s.DryRun {
+			// Errors of the cache (e.g. an unreachable remote) are handled as misses, so that
+			// the task is executed instead. However, unsafe entries fail the task, since the
+			// cache might have been tampered with.
+			ok, err := r.Task.RestoreArtifacts(s.Cache, key, s.Dir)
+			var u *UnsafePathError
+			if errors.As(err, &u) {
+				fail(err)
+				r.Reason = "rejected cache entry"
+				return
+			}
+			if err != nil {
+				r.Warnings = append(r.Warnings, fmt.Sprintf("failed to restore artifacts from cache: %s", err))
+			}
+			if ok {
+				r.Status, r.Reason = Cached, fmt.Sprintf("restored from cache (%.12s)", key)
+				return
+			}
+		}
+	}
+
+	if s.DryRun {
+		r.Status = Planned
+		return
+	}
+
+	why, start := r.Reason, time.Now()
+	for {
+		r.Reason = why
+		a := s.attempt(ctx, r)
+		r.Attempts = append(r.Attempts, a)
+		if r.Status != Failed || !r.Task.retry(len(r.Attempts), r.ExitCode) {
+			break
+		}
+		d := r.Task.retryDelay(len(r.Attempts))
+		fmt.Fprintf(s.out, "task %s: attempt %d/%d failed (exit code %d); retrying in %s\n", r.Task.DOTID, len(r.Attempts), r.Task.Retries+1, r.ExitCode, d)
+		// The task is not retried if the context is done while waiting
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+		case <-t.C:
+			continue
+		}
+		break
+	}
+	r.Duration = time.Since(start)
+	if len(r.Attempts) > 1 {
+		r.Reason = strings.TrimSpace(fmt.Sprintf("%s (attempt %d/%d)", r.Reason, len(r.Attempts), r.Task.Retries+1))
+	}
+
+	if r.Status == Succeeded && key != "" && len(r.Task.Artifacts) != 0 {
+		if err := r.Task.SaveArtifacts(s.Cache, key, s.Dir); err != nil {
+			r.Warnings = append(r.Warnings, fmt.Sprintf("failed to save artifacts to cache: %s", err))
+		}
+	}
+}
+
+// attempt executes the task of a result once, and sets the status, the exit code and the
+// error of the result. The captured output is reset before the execution.
+func (s *Scheduler) attempt(ctx context.Context, r *Result) Attempt {
+	var w io.Writer
+	var grp *bytes.Buffer
+	if s.Verbose {
+		switch s.Output {
+		case Group:
+			grp = new(bytes.Buffer)
+			w = grp
+		case Prefixed:
+			w = prefixWriter{prefix(r.Task.DOTID, s.Color), s.out}
+		default:
+			w = s.out
+		}
+	}
+
+	r.Stdout.Reset()
+	r.Stderr.Reset()
+	start := time.Now()
+	r.Err = r.Task.Exec(ctx, s.GracePeriod, s.Dir, &r.Stdout, &r.Stderr, w)
+	a := Attempt{Duration: time.Since(start)}
+	if grp != nil && grp.Len() != 0 {
+		_, _ = s.out.Write(grp.Bytes())
+	}
+	if r.Err == nil {
+		r.Status, r.ExitCode = Succeeded, 0
+		return a
+	}
+	r.Status = Failed
+	r.ExitCode = -1
+	switch {
+	case errors.Is(r.Err, context.DeadlineExceeded):
+		r.Reason = "timed out"
+		if r.Task.Timeout > 0 {
+			r.Reason += " after " + r.Task.Timeout.String()
+		}
+	case errors.Is(r.Err, context.Canceled):
+		r.Status, r.Reason = Cancelled, "interrupted"
+	}
+	var e *exec.ExitError
+	if errors.As(r.Err, &e) {
+		r.ExitCode = e.ExitCode()
+	}
+	a.ExitCode, a.Err = r.ExitCode, r.Err
+	return a
+}
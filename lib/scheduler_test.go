@@ -0,0 +1,508 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbhi/run/cache"
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+)
+
+func newTestGraph(t *testing.T, src string) *dep.DependencyGraph {
+	g := dot.Unmarshal([]byte(src))
+	if g == nil {
+		t.Fatal("failed to parse DOT source")
+	}
+	return dep.NewDependencyGraph(g)
+}
+
+const testGraph = `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB"];
+objA   [type="OBJ"];
+buildB [type="JOB"];
+buildC [type="JOB"];
+srcA -> buildA -> objA -> buildB;
+}`
+
+func testTasks(t *testing.T, d *dep.DependencyGraph, cmds map[string]string) []*Task {
+	cfg := &Config{Jobs: make(Jobs)}
+	for k, v := range cmds {
+		cfg.Jobs["JOB|"+k] = Job{Cmds: []string{v}}
+	}
+	ts, err := GetTasks(d, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func TestSchedulerRun(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	s := NewScheduler(d, testTasks(t, d, map[string]string{
+		"buildA": "echo A",
+		"buildB": "echo B",
+		"buildC": "echo C >&2",
+	}))
+	s.Jobs = 2
+	rs, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(rs))
+	}
+	for _, r := range rs {
+		if r.Status != Succeeded {
+			t.Errorf("task %s: expected %s, got %s", r.Task.DOTID, Succeeded, r.Status)
+		}
+		if r.Task.DOTID == "buildC" && r.Stderr.String() != "C\n" {
+			t.Errorf("task %s: unexpected stderr %q", r.Task.DOTID, r.Stderr.String())
+		}
+	}
+}
+
+func TestSchedulerRunFailure(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	s := NewScheduler(d, testTasks(t, d, map[string]string{
+		"buildA": "exit 3",
+		"buildB": "true",
+		"buildC": "true",
+	}))
+	s.Jobs = 1
+	rs, err := s.Run()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, r := range rs {
+		switch r.Task.DOTID {
+		case "buildA":
+			if r.Status != Failed || r.ExitCode != 3 {
+				t.Errorf("task %s: expected %s with exit code 3, got %s with %d", r.Task.DOTID, Failed, r.Status, r.ExitCode)
+			}
+		case "buildB":
+			if r.Status != Blocked {
+				t.Errorf("task %s: expected %s, got %s", r.Task.DOTID, Blocked, r.Status)
+			}
+		}
+	}
+}
+
+func TestSchedulerRunCache(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB"];
+objA   [type="OBJ"];
+srcA -> buildA -> objA;
+}`)
+	cfg := &Config{Jobs: Jobs{
+		"SRC|srcA":   Job{Data: []string{"a.c"}},
+		"JOB|buildA": Job{Cmds: []string{"cp a.c a.o", "echo run >> log"}},
+		"OBJ|objA":   Job{Data: []string{"a.o"}},
+	}}
+	if err := os.WriteFile(filepath.Join(dir, "a.c"), []byte("int a;"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(s Status) {
+		ts, err := GetTasks(d, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := NewScheduler(d, ts)
+		x.Dir = dir
+		x.Cache = cache.NewLocal(filepath.Join(dir, ".run", "cache"), 0)
+		rs, err := x.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rs[0].Status != s {
+			t.Errorf("expected %s, got %s (%s)", s, rs[0].Status, rs[0].Reason)
+		}
+	}
+
+	run(Succeeded)
+	run(Skipped)
+	if err := os.Remove(filepath.Join(dir, "a.o")); err != nil {
+		t.Fatal(err)
+	}
+	run(Cached)
+	if b, err := os.ReadFile(filepath.Join(dir, "a.o")); err != nil || string(b) != "int a;" {
+		t.Errorf("unexpected restored artifact %q (%v)", b, err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "log")); err != nil || string(b) != "run\n" {
+		t.Errorf("expected a single execution, got %q (%v)", b, err)
+	}
+}
+
+func TestSchedulerRunDryRun(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, testGraph)
+	s := NewScheduler(d, testTasks(t, d, map[string]string{
+		"buildA": "touch a",
+		"buildB": "touch b",
+		"buildC": "touch c",
+	}))
+	s.Dir = dir
+	s.DryRun = true
+	rs, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.Status != Planned {
+			t.Errorf("task %s: expected %s, got %s", r.Task.DOTID, Planned, r.Status)
+		}
+	}
+	if fs, _ := os.ReadDir(dir); len(fs) != 0 {
+		t.Errorf("expected no files to be created in dry-run mode, got %d", len(fs))
+	}
+}
+
+func TestSchedulerRunDryRunChain(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB"];
+objA   [type="OBJ"];
+buildB [type="JOB"];
+objB   [type="OBJ"];
+srcA -> buildA -> objA -> buildB -> objB;
+}`)
+	ts, err := GetTasks(d, &Config{Jobs: Jobs{
+		"SRC|srcA":   Job{Data: []string{"a.c"}},
+		"JOB|buildA": Job{Cmds: []string{"cp a.c a.o"}},
+		"OBJ|objA":   Job{Data: []string{"a.o"}},
+		"JOB|buildB": Job{Cmds: []string{"cp a.o b.o"}},
+		"OBJ|objB":   Job{Data: []string{"b.o"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// b.o is newer than a.o, but a.o is older than a.c; hence, buildB would be executed after
+	// buildA, even if it is up to date now
+	now := time.Now()
+	for i, f := range []string{"a.o", "b.o", "a.c"} {
+		p := filepath.Join(dir, f)
+		if err := os.WriteFile(p, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		m := now.Add(time.Duration(i-3) * time.Minute)
+		if err := os.Chtimes(p, m, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewScheduler(d, ts)
+	s.Dir = dir
+	s.DryRun = true
+	rs, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.Status != Planned {
+			t.Errorf("task %s: expected %s, got %s (%s)", r.Task.DOTID, Planned, r.Status, r.Reason)
+		}
+	}
+	if rs[1].Reason != "a dependency would be rebuilt" {
+		t.Errorf("unexpected reason for task %s: %s", rs[1].Task.DOTID, rs[1].Reason)
+	}
+}
+
+func TestSchedulerRunKeepGoing(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	ts := testTasks(t, d, map[string]string{
+		"buildA": "false",
+		"buildB": "true",
+		"buildC": "true",
+	})
+	for _, x := range []struct {
+		allow bool
+		b     Status
+		err   bool
+	}{
+		{false, Blocked, true},
+		{true, Succeeded, false},
+	} {
+		for _, task := range ts {
+			task.AllowFailure = x.allow && task.DOTID == "buildA"
+		}
+		s := NewScheduler(d, ts)
+		s.Jobs = 1
+		s.KeepGoing = true
+		rs, err := s.Run()
+		if (err != nil) != x.err {
+			t.Errorf("allow_failure=%t: unexpected error %v", x.allow, err)
+		}
+		for _, r := range rs {
+			e := map[string]Status{"buildA": Failed, "buildB": x.b, "buildC": Succeeded}[r.Task.DOTID]
+			if r.Status != e {
+				t.Errorf("allow_failure=%t: task %s: expected %s, got %s", x.allow, r.Task.DOTID, e, r.Status)
+			}
+		}
+	}
+}
+
+func TestSchedulerRunResume(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, testGraph)
+	cfg := &Config{Jobs: Jobs{
+		"JOB|buildA": Job{Cmds: []string{"echo A >> log"}},
+		"JOB|buildB": Job{Cmds: []string{"test -f ok"}},
+		"JOB|buildC": Job{Cmds: []string{"echo C >> log"}},
+	}}
+	run := func(ok bool) []*Result {
+		ts, err := GetTasks(d, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewScheduler(d, ts)
+		s.Target = "test"
+		s.Dir = dir
+		s.StateDir = filepath.Join(dir, ".run", "state")
+		s.Resume = true
+		s.KeepGoing = true
+		rs, err := s.Run()
+		if (err == nil) != ok {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return rs
+	}
+	run(false)
+	if err := os.WriteFile(filepath.Join(dir, "ok"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range run(true) {
+		e := map[string]Status{"buildA": Skipped, "buildB": Succeeded, "buildC": Skipped}[r.Task.DOTID]
+		if r.Status != e {
+			t.Errorf("task %s: expected %s, got %s (%s)", r.Task.DOTID, e, r.Status, r.Reason)
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "log")); err != nil || len(b) != 4 {
+		t.Errorf("expected buildA and buildC to be executed once, got %q (%v)", b, err)
+	}
+	s, err := ReadState(StateFile(filepath.Join(dir, ".run", "state"), "test"))
+	if err != nil || s == nil {
+		t.Fatalf("failed to read state: %v", err)
+	}
+	if x := s.Tasks["buildB"].Status; x != Succeeded.String() {
+		t.Errorf("expected state of buildB to be %s, got %s", Succeeded, x)
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	if f := StateFile("st", "bin.rv"); f != filepath.Join("st", "bin.rv.json") {
+		t.Errorf("expected name of subgraph to be kept, got %s", f)
+	}
+	m := make(map[string]string)
+	for _, x := range []string{"build*.fw", "build?.fw", "re:^src a$.fw", "bin.rv-(getA.rv,srcC.rv)", "a/b", strings.Repeat("x", 300)} {
+		f := StateFile("st", x)
+		n := filepath.Base(f)
+		if filepath.Dir(f) != "st" || len(n) > 150 || strings.ContainsAny(n, "*?:$ ()/,") {
+			t.Errorf("%s: unsafe state file %s", x, f)
+		}
+		if y, ok := m[f]; ok {
+			t.Errorf("targets %s and %s have the same state file %s", x, y, f)
+		}
+		m[f] = x
+	}
+}
+
+func TestSchedulerRunCancel(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	ts := testTasks(t, d, map[string]string{
+		"buildA": "sleep 0.2; exit 1",
+		"buildB": "true",
+		// The grandchild keeps the pipes open, unless the process group is killed
+		"buildC": "sleep 10 & wait",
+	})
+	for _, task := range ts {
+		if task.DOTID == "buildA" {
+			task.Timeout = 100 * time.Millisecond
+		}
+	}
+	s := NewScheduler(d, ts)
+	s.Jobs = 2
+	start := time.Now()
+	rs, err := s.Run()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if x := time.Since(start); x > 5*time.Second {
+		t.Errorf("expected tasks to be stopped, but run took %s", x)
+	}
+	for _, r := range rs {
+		switch r.Task.DOTID {
+		case "buildA":
+			if r.Status != Failed || !strings.HasPrefix(r.Reason, "timed out") {
+				t.Errorf("task %s: expected %s with timeout, got %s (%s)", r.Task.DOTID, Failed, r.Status, r.Reason)
+			}
+			var e *exec.ExitError
+			if !errors.Is(r.Err, context.DeadlineExceeded) || !errors.As(r.Err, &e) {
+				t.Errorf("task %s: expected the error of the context and the exit error, got %v", r.Task.DOTID, r.Err)
+			}
+		case "buildC":
+			if r.Status != Cancelled {
+				t.Errorf("task %s: expected %s, got %s (%s)", r.Task.DOTID, Cancelled, r.Status, r.Reason)
+			}
+		}
+	}
+}
+
+func TestSchedulerRunRetries(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, testGraph)
+	ts := testTasks(t, d, map[string]string{
+		// Fails with code 2 twice, and succeeds on the third attempt
+		"buildA": "echo x >> count; test $(wc -l < count) -ge 3 || exit 2",
+		"buildB": "true",
+		"buildC": "exit 1",
+	})
+	for _, task := range ts {
+		task.Retries, task.RetryDelay = 2, time.Millisecond
+		if task.DOTID == "buildC" {
+			task.RetryOn = []int{2}
+		}
+	}
+	s := NewScheduler(d, ts)
+	s.Dir = dir
+	s.KeepGoing = true
+	rs, _ := s.Run()
+	for _, r := range rs {
+		e, n := map[string]Status{"buildA": Succeeded, "buildB": Succeeded, "buildC": Failed}[r.Task.DOTID], map[string]int{"buildA": 3, "buildB": 1, "buildC": 1}[r.Task.DOTID]
+		if r.Status != e || len(r.Attempts) != n {
+			t.Errorf("task %s: expected %s after %d attempts, got %s after %d", r.Task.DOTID, e, n, r.Status, len(r.Attempts))
+		}
+	}
+}
+
+func TestSchedulerRunRetriesCancel(t *testing.T) {
+	d := newTestGraph(t, testGraph)
+	ts := testTasks(t, d, map[string]string{"buildA": "exit 1", "buildB": "true", "buildC": "true"})
+	for _, task := range ts {
+		task.Retries, task.RetryDelay = 5, time.Hour
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rs, err := NewScheduler(d, ts).RunContext(ctx)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if x := time.Since(start); x > 5*time.Second {
+		t.Errorf("expected retries to be stopped, but run took %s", x)
+	}
+	for _, r := range rs {
+		if r.Task.DOTID == "buildA" && len(r.Attempts) != 1 {
+			t.Errorf("task %s: expected 1 attempt, got %d", r.Task.DOTID, len(r.Attempts))
+		}
+	}
+}
+
+func TestTaskRetryDelay(t *testing.T) {
+	x := &Task{RetryDelay: time.Second}
+	for n, e := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 4: 8 * time.Second, 100: MaxRetryDelay} {
+		if d := x.retryDelay(n); d != e {
+			t.Errorf("attempt %d: expected %s, got %s", n, e, d)
+		}
+	}
+}
+
+func TestRestoreArtifactsOutside(t *testing.T) {
+	dir := t.TempDir()
+	s := cache.NewLocal(filepath.Join(dir, "cache"), 0)
+	h := sha256.Sum256([]byte("x"))
+	d := hex.EncodeToString(h[:])
+	if err := s.PutBlob(d, strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"../x", filepath.Join(dir, "x"), "a/../../x"} {
+		if err := s.PutAction(d, &cache.Action{Artifacts: []cache.Artifact{{Path: p, Digest: d, Mode: 0600}}}); err != nil {
+			t.Fatal(err)
+		}
+		task := &Task{}
+		var u *UnsafePathError
+		if ok, err := task.RestoreArtifacts(s, d, filepath.Join(dir, "work")); ok || !errors.As(err, &u) {
+			t.Errorf("expected artifact '%s' to be rejected, got %v", p, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "x")); err == nil {
+			t.Errorf("artifact '%s' was written outside of the working directory", p)
+		}
+	}
+}
+
+func TestSchedulerRunCacheUnsafe(t *testing.T) {
+	dir := t.TempDir()
+	d := newTestGraph(t, `strict digraph {
+buildA [type="JOB"];
+objA   [type="OBJ"];
+buildA -> objA;
+}`)
+	ts, err := GetTasks(d, &Config{Jobs: Jobs{
+		"JOB|buildA": Job{Cmds: []string{"echo a > a.o"}},
+		"OBJ|objA":   Job{Data: []string{"a.o"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := cache.NewLocal(filepath.Join(dir, ".run", "cache"), 0)
+	k, err := ts[0].Fingerprint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutAction(k, &cache.Action{Artifacts: []cache.Artifact{{Path: "../a.o", Digest: k}}}); err != nil {
+		t.Fatal(err)
+	}
+	x := NewScheduler(d, ts)
+	x.Dir, x.Cache = dir, s
+	rs, _ := x.Run()
+	var u *UnsafePathError
+	if rs[0].Status != Failed || !errors.As(rs[0].Err, &u) {
+		t.Errorf("expected %s with an UnsafePathError, got %s (%v)", Failed, rs[0].Status, rs[0].Err)
+	}
+}
+
+func TestSchedulerRunCacheUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	d := newTestGraph(t, `strict digraph {
+buildA [type="JOB"];
+objA   [type="OBJ"];
+buildA -> objA;
+}`)
+	ts, err := GetTasks(d, &Config{Jobs: Jobs{
+		"JOB|buildA": Job{Cmds: []string{"echo a > a.o"}},
+		"OBJ|objA":   Job{Data: []string{"a.o"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := NewScheduler(d, ts)
+	x.Dir = dir
+	x.Cache = cache.NewWriteThrough(cache.NewLocal(filepath.Join(dir, ".run", "cache"), 0), cache.NewHTTP(srv.URL, false))
+	rs, err := x.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs[0].Status != Succeeded {
+		t.Errorf("expected %s, got %s (%s)", Succeeded, rs[0].Status, rs[0].Reason)
+	}
+	if len(rs[0].Warnings) == 0 {
+		t.Errorf("expected a warning about saving the artifacts to the cache")
+	}
+}
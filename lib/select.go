@@ -0,0 +1,555 @@
+package lib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+/*
+Selection expressions combine sets of nodes:
+
+	expr     = diff { ',' diff }          union
+	diff     = inter { '-' inter }        exclusion
+	inter    = unary { '&' unary }        intersection
+	unary    = '(' expr ')' | selector
+	selector = KEY '=' VALUE | NODE[|TASK]
+
+A 'NODE[|TASK]' selector is the set of nodes of the subgraph returned by GetSubGraph (see
+parsearg). NODE and TASK can be shell globs ('build*') or regular expressions ('re:^obj'),
+which match the DOTID or the label of the nodes (see pattern); the result is the union of the
+subgraphs of the matched nodes. Quotes allow to use operators in patterns: "re:'^(a|b)$'".
+Prefix 'id:' selects the node with the given DOTID, even if it contains glob characters or
+starts with 're:' (e.g. 'id:a[1]').
+
+A 'KEY=VALUE' selector is the set of nodes with DOT attribute KEY equal to VALUE
+(case-insensitively). Key 'type' matches jobs defined through 'shape=box' too, key 'id'
+matches the DOTID and key 'ns' matches the namespace ('ns=fpga' or 'ns=::' for the root).
+
+Whitespace is ignored. A '-' is part of a name unless it starts a token, so exclusions need a
+space (or a parenthesis) before the operator: 'bin - getA'.
+*/
+
+// SyntaxError is returned when a selection expression is not valid. It matches ErrParse.
+type SyntaxError struct {
+	Expr string
+	// Pos is the position of the error in Expr; the index of the first character is 1.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d in '%s': %s", ErrParse, e.Pos, e.Expr, e.Msg)
+}
+
+// Is allows to match SyntaxError with errors.Is(err, ErrParse).
+func (e *SyntaxError) Is(target error) bool { return target == ErrParse }
+
+// Selection is a parsed selection expression.
+type Selection interface {
+	// String returns a name for the selection, which can be used in file names.
+	String() string
+	eval(c *selectContext) (map[int64]graph.Node, error)
+}
+
+// selectContext holds the subgraphs for the evaluation of a selection.
+type selectContext struct {
+	l, r map[string]*dep.DependencyGraph
+	full *dep.DependencyGraph
+}
+
+func (c *selectContext) graph() *dep.DependencyGraph {
+	if c.full == nil {
+		c.full = union(c.l)
+	}
+	return c.full
+}
+
+// nodeSelector is a 'NODE[|TASK]' selector, where NODE and TASK can be patterns.
+type nodeSelector struct {
+	key, task pattern
+	rv, fw    bool
+}
+
+func (s nodeSelector) String() string {
+	return subGraphName(s.key.text, s.task.text, s.rv, s.fw)
+}
+
+// literal returns true if neither NODE nor TASK are patterns.
+func (s nodeSelector) literal() bool {
+	return !s.key.isPattern() && !s.task.isPattern()
+}
+
+func (s nodeSelector) eval(c *selectContext) (map[int64]graph.Node, error) {
+	ks := s.key.nodes(c.graph())
+	if len(ks) == 0 {
+		return nil, &NodeNotFoundError{DOTID: s.key.text, Pattern: s.key.isPattern()}
+	}
+	o := make(map[int64]graph.Node)
+	found := false
+	for _, k := range ks {
+		if s.task.text == "" {
+			d, err := subGraph(c.l, c.r, c.graph, k, "", s.rv, s.fw)
+			if err != nil {
+				return nil, err
+			}
+			addNodes(o, d)
+			continue
+		}
+		b, err := subGraph(c.l, c.r, c.graph, k, "", true, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range s.task.nodes(b) {
+			d, err := induceNode(b, t, k, s.fw, s.rv)
+			if err != nil {
+				return nil, err
+			}
+			addNodes(o, d)
+			found = true
+		}
+	}
+	if s.task.text != "" && !found {
+		return nil, &NodeNotFoundError{DOTID: s.task.text, Subgraph: s.key.text, Pattern: s.task.isPattern()}
+	}
+	return o, nil
+}
+
+// attrSelector is a 'KEY=VALUE' selector.
+type attrSelector struct {
+	key, value string
+}
+
+func (s attrSelector) String() string { return s.key + "=" + s.value }
+
+func (s attrSelector) eval(c *selectContext) (map[int64]graph.Node, error) {
+	o := make(map[int64]graph.Node)
+	for _, n := range graph.NodesOf(c.graph().Nodes()) {
+		if s.match(n.(*dot.Node)) {
+			o[n.ID()] = n
+		}
+	}
+	return o, nil
+}
+
+func (s attrSelector) match(n *dot.Node) bool {
+	switch s.key {
+	case "id":
+		return n.DOTID() == s.value
+	case "type":
+		return strings.EqualFold(nodeType(n), s.value)
+	case "ns":
+		return n.Namespace() == dot.Qualify("", s.value)
+	}
+	a, err := n.Attribute(s.key)
+	return err == nil && strings.EqualFold(a, s.value)
+}
+
+// opSelection is the union (','), exclusion ('-') or intersection ('&') of two selections.
+type opSelection struct {
+	op   byte
+	l, r Selection
+}
+
+func (s opSelection) String() string {
+	f := func(x Selection) string {
+		if o, ok := x.(opSelection); ok && precedence(o.op) < precedence(s.op) {
+			return "(" + o.String() + ")"
+		}
+		return x.String()
+	}
+	r := f(s.r)
+	if o, ok := s.r.(opSelection); ok && precedence(o.op) == precedence(s.op) {
+		r = "(" + r + ")"
+	}
+	return f(s.l) + string(s.op) + r
+}
+
+func (s opSelection) eval(c *selectContext) (map[int64]graph.Node, error) {
+	a, err := s.l.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.r.eval(c)
+	if err != nil {
+		return nil, err
+	}
+	o := make(map[int64]graph.Node)
+	switch s.op {
+	case ',':
+		for k, v := range a {
+			o[k] = v
+		}
+		for k, v := range b {
+			o[k] = v
+		}
+	case '&':
+		for k, v := range a {
+			if _, ok := b[k]; ok {
+				o[k] = v
+			}
+		}
+	case '-':
+		for k, v := range a {
+			if _, ok := b[k]; !ok {
+				o[k] = v
+			}
+		}
+	}
+	return o, nil
+}
+
+func precedence(op byte) int {
+	switch op {
+	case '&':
+		return 2
+	case '-':
+		return 1
+	}
+	return 0
+}
+
+// token is a lexeme of a selection expression; either an operator or a word.
+type token struct {
+	pos  int
+	op   byte
+	word string
+}
+
+func (t *token) String() string {
+	if t.op != 0 {
+		return string(t.op)
+	}
+	return t.word
+}
+
+// isOp returns true if 'r' is an operator, or a delimiter.
+func isOp(r rune) bool {
+	return strings.ContainsRune(",&()=", r)
+}
+
+// tokenize splits 's' in tokens. Quoted text (with ' or ") is part of a word, even if it
+// contains whitespace or operators.
+func tokenize(s string) ([]token, error) {
+	o := make([]token, 0)
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		switch r := rs[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case isOp(r) || r == '-':
+			o = append(o, token{pos: i + 1, op: byte(r)})
+			i++
+		default:
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !isOp(rs[j]) {
+				if q := rs[j]; q == '\'' || q == '"' {
+					k := j + 1
+					for k < len(rs) && rs[k] != q {
+						k++
+					}
+					if k == len(rs) {
+						return nil, &SyntaxError{Expr: s, Pos: j + 1, Msg: fmt.Sprintf("unterminated quote %c", q)}
+					}
+					j = k
+				}
+				j++
+			}
+			o = append(o, token{pos: i + 1, word: string(rs[i:j])})
+			i = j
+		}
+	}
+	return o, nil
+}
+
+// splitUnquoted splits 's' at each 'sep' which is not quoted.
+func splitUnquoted(s string, sep rune) []string {
+	o := make([]string, 0)
+	var q rune
+	i := 0
+	for j, r := range s {
+		switch {
+		case q != 0:
+			if r == q {
+				q = 0
+			}
+		case r == '\'' || r == '"':
+			q = r
+		case r == sep:
+			o = append(o, s[i:j])
+			i = j + 1
+		}
+	}
+	return append(o, s[i:])
+}
+
+// unquote removes the quotes from 's'.
+func unquote(s string) string {
+	var b strings.Builder
+	var q rune
+	for _, r := range s {
+		switch {
+		case q != 0 && r == q:
+			q = 0
+		case q == 0 && (r == '\'' || r == '"'):
+			q = r
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parser is a recursive descent parser of selection expressions.
+type parser struct {
+	expr string
+	ts   []token
+	i    int
+}
+
+func (p *parser) peek() *token {
+	if p.i < len(p.ts) {
+		return &p.ts[p.i]
+	}
+	return nil
+}
+
+func (p *parser) errorf(t *token, f string, a ...interface{}) error {
+	pos := len([]rune(p.expr)) + 1
+	if t != nil {
+		pos = t.pos
+	}
+	return &SyntaxError{Expr: p.expr, Pos: pos, Msg: fmt.Sprintf(f, a...)}
+}
+
+// binary parses a sequence of operands joined by operator 'op'; operations are
+// left-associative.
+func (p *parser) binary(op byte, operand func() (Selection, error)) (Selection, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t != nil && t.op == op; t = p.peek() {
+		p.i++
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		l = opSelection{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) union() (Selection, error) {
+	return p.binary(',', p.diff)
+}
+
+func (p *parser) diff() (Selection, error) {
+	return p.binary('-', p.inter)
+}
+
+func (p *parser) inter() (Selection, error) {
+	return p.binary('&', p.unary)
+}
+
+func (p *parser) unary() (Selection, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, p.errorf(nil, "unexpected end of expression")
+	}
+	if t.op == '(' {
+		p.i++
+		s, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		if c := p.peek(); c == nil || c.op != ')' {
+			return nil, p.errorf(c, "expected ')' to close '(' at position %d", t.pos)
+		}
+		p.i++
+		return s, nil
+	}
+	if t.op != 0 {
+		return nil, p.errorf(t, "expected a node or a selector, got '%c'", t.op)
+	}
+	p.i++
+	if e := p.peek(); e != nil && e.op == '=' {
+		p.i++
+		v := p.peek()
+		if v == nil || v.op != 0 {
+			return nil, p.errorf(v, "expected a value for key '%s'", t.word)
+		}
+		p.i++
+		return attrSelector{key: t.word, value: v.word}, nil
+	}
+	x, err := parseNode(t.word)
+	if err != "" {
+		return nil, p.errorf(t, "%s", err)
+	}
+	return x, nil
+}
+
+// parseNode parses 'NODE[|TASK]' selector 'a' (see parsearg), where NODE and TASK can be
+// patterns. If it is not valid, the description of the problem is returned.
+func parseNode(a string) (nodeSelector, string) {
+	o := nodeSelector{}
+	s := splitUnquoted(a, '|')
+	if len(s) > 2 {
+		return o, fmt.Sprintf("more than one '|' in '%s'", a)
+	}
+	markers := func(x string) string {
+		if strings.HasPrefix(x, ">") {
+			x, o.rv = x[1:], true
+		}
+		if strings.HasSuffix(x, ">") {
+			x, o.fw = x[:len(x)-1], true
+		}
+		if !(o.rv || o.fw) {
+			o.rv = true
+		}
+		return x
+	}
+	k, t := s[0], ""
+	if len(s) > 1 && s[1] != "" {
+		if strings.HasPrefix(k, ">") || strings.HasSuffix(k, ">") {
+			return o, fmt.Sprintf("invalid node in '%s'; the direction applies to the task", a)
+		}
+		if t = markers(s[1]); t == "" {
+			return o, fmt.Sprintf("empty task name in '%s'", a)
+		}
+	} else {
+		k = markers(k)
+	}
+	if k == "" {
+		return o, fmt.Sprintf("empty node name in '%s'", a)
+	}
+	var err error
+	if o.key, err = newPattern("", unquote(k)); err != nil {
+		return o, err.Error()
+	}
+	if t != "" {
+		// The task is relative to the namespace of the node (see qualifyTask), unless the node
+		// is a pattern, since it might match nodes in several namespaces
+		ns := ""
+		if !o.key.isPattern() {
+			ns, _ = dot.SplitNamespace(o.key.text)
+		}
+		if o.task, err = newPattern(ns, unquote(t)); err != nil {
+			return o, err.Error()
+		}
+	}
+	return o, ""
+}
+
+// QuoteNode returns a NODE selector (see ParseSelection) which matches the node with DOTID
+// 'id' exactly, and no other node, whatever its label. Plain names are returned as is; other
+// names (e.g. with whitespace, operators, quotes or glob characters) are converted to a quoted
+// literal DOTID ('id:...').
+func QuoteNode(id string) string {
+	plain := id != "" && !strings.HasPrefix(id, "re:") && !strings.HasPrefix(id, "id:") && !strings.HasPrefix(id, "-")
+	for _, r := range id {
+		plain = plain && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:-", r))
+	}
+	if plain {
+		return id
+	}
+	// Quotes cannot be nested, so each single quote is closed, double quoted and reopened
+	return "'id:" + strings.ReplaceAll(id, "'", `'"'"'`) + "'"
+}
+
+// ParseSelection parses selection expression 's'. A SyntaxError is returned if it is not
+// valid.
+func ParseSelection(s string) (Selection, error) {
+	ts, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: s, ts: ts}
+	x, err := p.union()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, p.errorf(t, "unexpected '%s'", t)
+	}
+	return x, nil
+}
+
+// Select returns the subgraph for selection expression 'expr', along with a name for it. If
+// the expression is a single 'NODE[|TASK]' selector without patterns, the result is the same
+// as GetSubGraph. A NodeNotFoundError is returned if a node, task or pattern matches nothing.
+// Otherwise, the subgraph contains the selected nodes, and there is an edge between two of
+// them if there is a path in the graph (see dep.Reduce). Hence, the dependencies between the
+// selected nodes are kept, even if the nodes in between are not selected.
+func Select(l, r map[string]*dep.DependencyGraph, expr string) (*dep.DependencyGraph, string, error) {
+	s, err := ParseSelection(expr)
+	if err != nil {
+		return nil, "", err
+	}
+	c := &selectContext{l: l, r: r}
+	if x, ok := s.(nodeSelector); ok && x.literal() {
+		d, err := subGraph(l, r, c.graph, x.key.text, x.task.text, x.rv, x.fw)
+		return d, x.String(), err
+	}
+	m, err := s.eval(c)
+	if err != nil {
+		return nil, "", err
+	}
+	d, err := induceSet(c.graph(), m)
+	return d, s.String(), err
+}
+
+// induceSet returns a graph with the nodes in 'm' and the edges of 'd' between them. Moreover,
+// an edge u->v is added for each pair of nodes where v can be reached from u in 'd' only
+// through nodes which are not in 'm', so that the order between them is kept. Existing nodes
+// and edges are shared with 'd'.
+func induceSet(d *dep.DependencyGraph, m map[int64]graph.Node) (*dep.DependencyGraph, error) {
+	ns := make([]graph.Node, 0, len(m))
+	for _, n := range m {
+		ns = append(ns, n)
+	}
+	sort.Slice(ns, func(i, j int) bool { return ns[i].ID() < ns[j].ID() })
+	o := dep.NewDependencyGraph(nil)
+	c := dep.NewDependencyGraph(nil)
+	for _, n := range ns {
+		o.AddNode(n)
+		c.AddNode(n)
+	}
+	for _, u := range ns {
+		for _, v := range ns {
+			if u.ID() == v.ID() || !d.Reaches(u.ID(), v.ID()) {
+				continue
+			}
+			if e := d.Edge(u.ID(), v.ID()); e != nil {
+				o.SetEdge(e)
+				c.SetEdge(e)
+				continue
+			}
+			c.SetEdge(simple.Edge{F: u, T: v})
+		}
+	}
+	// The edges of the reduction which are not in 'd' are the missing dependencies
+	x, err := c.Reduce()
+	if err != nil {
+		return nil, cycleError(c, err)
+	}
+	for _, e := range graph.EdgesOf(x.Edges()) {
+		if !o.HasEdgeFromTo(e.From().ID(), e.To().ID()) {
+			o.SetEdge(e)
+		}
+	}
+	return o, nil
+}
+
+// addNodes adds the nodes of graph 'd' to map 'm', where the key is the ID.
+func addNodes(m map[int64]graph.Node, d *dep.DependencyGraph) {
+	for _, n := range graph.NodesOf(d.Nodes()) {
+		m[n.ID()] = n
+	}
+}
@@ -0,0 +1,213 @@
+package lib
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestParseSelection(t *testing.T) {
+	for _, x := range []struct {
+		expr string
+		name string
+	}{
+		{"bin", "bin.rv"},
+		{"bin,doc", "bin.rv,doc.rv"},
+		{" >objB & buildA> ", "objB.rv&buildA.fw"},
+		{"bin - getA", "bin.rv-getA.rv"},
+		{"bin - (getA, srcC)", "bin.rv-(getA.rv,srcC.rv)"},
+		{"bin,doc & type=JOB", "bin.rv,doc.rv&type=JOB"},
+		{"(bin,doc) & type=JOB", "(bin.rv,doc.rv)&type=JOB"},
+		{"a - b - c", "a.rv-b.rv-c.rv"},
+		{"a - (b - c)", "a.rv-(b.rv-c.rv)"},
+		{"build-a|>obj-b", "build-a.obj-b"},
+		{"build*>", "build*.fw"},
+		{"bin|>re:'^(objA|objB)$'", "bin.re:^(objA|objB)$"},
+		// Tasks are relative to the namespace of the node, unless it is a pattern
+		{"fpga::bin|build", "fpga::bin.fpga::build"},
+		{"fpga::*|build", "fpga::*.build"},
+		{"re:x::y$|build", "re:x::y$.build"},
+		{"re:'x::y$|build'|build", "re:x::y$|build.build"},
+		{"id:fpga::a[1]|build", "fpga::a[1].fpga::build"},
+	} {
+		s, err := ParseSelection(x.expr)
+		if err != nil {
+			t.Errorf("%s: %v", x.expr, err)
+			continue
+		}
+		if n := s.String(); n != x.name {
+			t.Errorf("%s: expected %s, got %s", x.expr, x.name, n)
+		}
+	}
+}
+
+func TestParseSelectionError(t *testing.T) {
+	for _, x := range []struct {
+		expr string
+		pos  int
+	}{
+		{"", 1},
+		{"bin,", 5},
+		{"bin & & doc", 7},
+		{"(bin, doc", 10},
+		{"bin doc", 5},
+		{"type=", 6},
+		{"bin)", 4},
+		{"bin|>", 1},
+		{"a|b|c", 1},
+		{"bin - >", 7},
+		{"bin|'objA", 5},
+		{"re:(", 4},
+		{"re:'('", 1},
+		{"build[", 1},
+	} {
+		_, err := ParseSelection(x.expr)
+		if !errors.Is(err, ErrParse) {
+			t.Errorf("'%s': expected ErrParse, got %v", x.expr, err)
+			continue
+		}
+		var e *SyntaxError
+		if !errors.As(err, &e) || e.Pos != x.pos {
+			t.Errorf("'%s': expected an error at position %d, got %v", x.expr, x.pos, err)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	d, err := ReadGraphFromFile("../example/graph.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, r := InduceSubGraphs(d)
+	for _, x := range []struct {
+		expr  string
+		nodes string
+		tasks string
+	}{
+		{"bin", "bin build buildA buildB getA objA objB srcA srcB srcC", "getA buildA buildB build"},
+		{"bin,doc", "bin build buildA buildB buildDoc doc getA objA objB srcA srcB srcC srcDoc", ""},
+		{">objB & buildA>", "buildA buildB objA objB", "buildA buildB"},
+		{"bin - getA", "bin build buildA buildB objA objB srcA srcB srcC", "buildA buildB build"},
+		{"(bin, doc) & type=JOB", "build buildA buildB buildDoc getA", ""},
+		{"bin & type=JOB", "build buildA buildB getA", "getA buildA buildB build"},
+		{"type=obj - id=doc", "bin objA objB", ""},
+		{"bin & doc", "", ""},
+		// Patterns
+		{"obj*>", "bin build buildB objA objB", "buildB build"},
+		{"re:^src[AB]$ & type=SRC", "srcA srcB", ""},
+		{"bin|>build?", "buildA buildB getA objA srcA srcB", "getA buildA buildB"},
+		{"re:'^(bin|doc)$'", "bin build buildA buildB buildDoc doc getA objA objB srcA srcB srcC srcDoc", ""},
+	} {
+		s, _, err := Select(l, r, x.expr)
+		if err != nil {
+			t.Errorf("%s: %v", x.expr, err)
+			continue
+		}
+		ns := make([]string, 0)
+		for _, n := range graph.NodesOf(s.Nodes()) {
+			ns = append(ns, n.(*dot.Node).DOTID())
+		}
+		sort.Strings(ns)
+		if strings.Join(ns, " ") != x.nodes {
+			t.Errorf("%s: expected nodes [%s], got [%s]", x.expr, x.nodes, strings.Join(ns, " "))
+		}
+		if x.tasks == "" {
+			continue
+		}
+		// The order between the selected tasks is kept, even if the nodes in between are not selected
+		ts, err := GetTaskList(s)
+		if err != nil || strings.Join(ts, " ") != x.tasks {
+			t.Errorf("%s: expected tasks [%s], got [%s] (%v)", x.expr, x.tasks, strings.Join(ts, " "), err)
+		}
+	}
+	for _, x := range []string{"bin - missing", "missing*", "re:^x", "bin|>doc*", "doc|re:^obj"} {
+		if _, _, err := Select(l, r, x); !errors.Is(err, ErrNodeNotFound) {
+			t.Errorf("%s: expected ErrNodeNotFound, got %v", x, err)
+		}
+	}
+}
+
+func TestSelectID(t *testing.T) {
+	l, r := InduceSubGraphs(newTestGraph(t, `strict digraph {
+"a[1]" -> bin;
+a1 -> bin;
+"re:x" -> bin;
+}`))
+	for _, x := range []struct {
+		expr  string
+		nodes string
+	}{
+		{"a[1]>", "a1 bin"},
+		{"id:a[1]>", "a[1] bin"},
+		{"id:re:x>", "bin re:x"},
+		{"bin|id:a[1]>", "a[1] bin"},
+		{"id:a[1]> & id=bin", "bin"},
+	} {
+		s, _, err := Select(l, r, x.expr)
+		if err != nil {
+			t.Errorf("%s: %v", x.expr, err)
+			continue
+		}
+		ns := make([]string, 0)
+		for _, n := range graph.NodesOf(s.Nodes()) {
+			ns = append(ns, n.(*dot.Node).DOTID())
+		}
+		sort.Strings(ns)
+		if strings.Join(ns, " ") != x.nodes {
+			t.Errorf("%s: expected nodes [%s], got [%s]", x.expr, x.nodes, strings.Join(ns, " "))
+		}
+	}
+	_, _, err := Select(l, r, "id:a[2]")
+	var e *NodeNotFoundError
+	if !errors.As(err, &e) || e.Pattern || e.DOTID != "a[2]" {
+		t.Errorf("expected node 'a[2]' not to be found, got %v", err)
+	}
+}
+
+func TestQuoteNode(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+"src a" -> bin;
+"it's" -> bin;
+"x,y\"z" -> bin;
+"g*" -> bin;
+g1 -> bin;
+"re:x" -> bin;
+"fpga::build" -> bin;
+"id:y" -> bin;
+"a[1]" -> bin;
+a1 -> bin;
+// The labels match the DOTIDs of other nodes
+label [label="src a"];
+label -> bin;
+label2 [label="a[1]"];
+label2 -> bin;
+}`)
+	l, r := InduceSubGraphs(d)
+	for _, id := range []string{"src a", "it's", `x,y"z`, "g*", "re:x", "fpga::build", "id:y", "a[1]", "bin"} {
+		s, _, err := Select(l, r, QuoteNode(id)+">")
+		if err != nil {
+			t.Errorf("%s: %v", id, err)
+			continue
+		}
+		ns := make([]string, 0)
+		for _, n := range graph.NodesOf(s.Nodes()) {
+			ns = append(ns, n.(*dot.Node).DOTID())
+		}
+		sort.Strings(ns)
+		e := []string{"bin", id}
+		if id == "bin" {
+			e = e[:1]
+		}
+		sort.Strings(e)
+		if strings.Join(ns, "|") != strings.Join(e, "|") {
+			t.Errorf("%s: expected nodes %q, got %q", id, e, ns)
+		}
+	}
+	if q := QuoteNode("srcA"); q != "srcA" {
+		t.Errorf("expected plain name to be kept, got %s", q)
+	}
+}
@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// signalKey is the key of the received signal in the contexts created with NotifyContext.
+type signalKey struct{}
+
+// received holds the signal that cancelled a context.
+type received struct {
+	mu  sync.Mutex
+	sig os.Signal
+}
+
+// NotifyContext returns a context which is cancelled when SIGINT or SIGTERM is received. The
+// signal is forwarded to the process groups of the commands executed with the context (see
+// ExecCmdContext). The returned function stops listening for signals and cancels the context.
+func NotifyContext(parent context.Context) (context.Context, context.CancelFunc) {
+	r := &received{}
+	ctx, cancel := context.WithCancel(context.WithValue(parent, signalKey{}, r))
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case s := <-ch:
+			r.mu.Lock()
+			r.sig = s
+			r.mu.Unlock()
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(ch)
+		cancel()
+	}
+}
+
+// contextSignal returns the signal that cancelled the context, or SIGTERM if the context
+// was cancelled otherwise (e.g. a deadline was exceeded).
+func contextSignal(ctx context.Context) os.Signal {
+	if r, ok := ctx.Value(signalKey{}).(*received); ok {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.sig != nil {
+			return r.sig
+		}
+	}
+	return syscall.SIGTERM
+}
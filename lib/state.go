@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TaskState is the outcome of a task in a run, as saved in a State.
+type TaskState struct {
+	Status      string        `json:"status"`
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	ExitCode    int           `json:"exit_code"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// State is the journal of a run; the state of each of the tasks in the subgraph of a target.
+type State struct {
+	Target  string               `json:"target"`
+	Updated time.Time            `json:"updated"`
+	Tasks   map[string]TaskState `json:"tasks"`
+}
+
+// StateFile returns the location of the state file for 'target' in directory 'dir'. If
+// 'target' is empty, 'default' is used. Names of subgraphs (such as 'bin.rv') are used as is.
+// Other targets (e.g. selection expressions with globs or regular expressions) might not be
+// valid file names, so the characters other than letters, digits, '.', '_' and '-' are
+// replaced, long names are truncated, and a hash of the target is appended to avoid
+// collisions.
+func StateFile(dir, target string) string {
+	if target == "" {
+		target = "default"
+	}
+	safe := len(target) <= maxStateName
+	n := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("._-", r)) {
+			return r
+		}
+		safe = false
+		return '_'
+	}, target)
+	if !safe {
+		if len(n) > maxStateName {
+			n = n[:maxStateName]
+		}
+		h := sha256.Sum256([]byte(target))
+		n += "-" + hex.EncodeToString(h[:])[:12]
+	}
+	return filepath.Join(dir, n+".json")
+}
+
+// maxStateName is the maximum length of the names of state files, before the hash.
+const maxStateName = 100
+
+// ReadState reads a state file. If the file does not exist, nil is returned.
+func ReadState(f string) (*State, error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	s := &State{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write saves the state to file 'f' atomically, by writing to a temporary file first.
+func (s *State) Write(f string) error {
+	s.Updated = time.Now()
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f), 0750); err != nil {
+		return err
+	}
+	t := f + ".tmp"
+	if err := os.WriteFile(t, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(t, f)
+}
+
+// update sets the state of the task of result 'r'.
+func (s *State) update(r *Result) {
+	s.Tasks[r.Task.DOTID] = TaskState{
+		Status:      r.Status.String(),
+		Fingerprint: r.Fingerprint,
+		ExitCode:    r.ExitCode,
+		Duration:    r.Duration,
+	}
+}
+
+// done returns true if the task succeeded (or was skipped) in the run and the fingerprint
+// of its inputs did not change since then.
+func (s *State) done(t string, fingerprint string) bool {
+	if s == nil {
+		return false
+	}
+	x, ok := s.Tasks[t]
+	if !ok || x.Fingerprint == "" || x.Fingerprint != fingerprint {
+		return false
+	}
+	switch x.Status {
+	case Succeeded.String(), Skipped.String(), Cached.String():
+		return true
+	}
+	return false
+}
@@ -1,12 +1,18 @@
 package lib
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/dbhi/run/dep"
 	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
 )
 
 type Task struct {
@@ -18,6 +24,50 @@ type Task struct {
 	Sources     map[string]string
 	Artifacts   map[string]string
 	Results     map[string]string
+	// AllowFailure makes the tasks which depend on this one to be executed even if it fails.
+	AllowFailure bool
+	// Timeout is the maximum duration of the execution of the task. If zero, no limit is applied.
+	Timeout time.Duration
+	// Retries is the number of times that the task is executed again after failing.
+	Retries int
+	// RetryDelay is the time to wait before the first retry. It is doubled for each retry,
+	// up to MaxRetryDelay.
+	RetryDelay time.Duration
+	// RetryOn are the exit codes that trigger a retry. If empty, any failure does.
+	RetryOn []int
+}
+
+// retry returns true if the task should be executed again after 'n' failed attempts, the
+// last of which exited with code 'code'.
+func (t *Task) retry(n, code int) bool {
+	if n > t.Retries {
+		return false
+	}
+	if len(t.RetryOn) == 0 {
+		return true
+	}
+	for _, c := range t.RetryOn {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxRetryDelay is the maximum time to wait before a retry (see Task.RetryDelay).
+const MaxRetryDelay = 10 * time.Minute
+
+// retryDelay returns the time to wait before retrying the task after 'n' failed attempts: the
+// RetryDelay doubled for each previous retry, up to MaxRetryDelay.
+func (t *Task) retryDelay(n int) time.Duration {
+	d := t.RetryDelay
+	for i := 1; i < n && d < MaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > MaxRetryDelay {
+		return MaxRetryDelay
+	}
+	return d
 }
 
 /*
@@ -54,23 +104,168 @@ func GetTaskListAll(d map[string]*dep.DependencyGraph) [][]string {
 	return nil
 }
 */
-func GetTaskList(d *dep.DependencyGraph) []string {
+// GetTaskList returns the DOTIDs of the tasks of a (sub)graph in topological order. A
+// CycleError is returned if the graph is not acyclic.
+func GetTaskList(d *dep.DependencyGraph) ([]string, error) {
 	s, err := d.Sort()
-	checkErr(err)
+	if err != nil {
+		return nil, cycleError(d, err)
+	}
 	o := make([]string, 0)
 	for _, n := range s {
-		x := n.(*dot.Node)
-		if a, e := x.Attribute("shape"); e == nil && strings.ToLower(a) == "box" {
+		if x := n.(*dot.Node); isJob(x) {
 			o = append(o, x.DOTID())
+		}
+	}
+	return o, nil
+}
+
+// isJob returns true if the node is a task; i.e. it has attribute 'shape=box' or 'type=JOB'.
+func isJob(n *dot.Node) bool {
+	if a, e := n.Attribute("shape"); e == nil && strings.ToLower(a) == "box" {
+		return true
+	}
+	if a, e := n.Attribute("type"); e == nil && strings.ToLower(a) == "job" {
+		return true
+	}
+	return false
+}
+
+// nodeType returns the value of attribute 'type' of the node, or 'JOB' if the node is a box.
+func nodeType(n *dot.Node) string {
+	if a, e := n.Attribute("type"); e == nil {
+		return strings.ToUpper(a)
+	}
+	if isJob(n) {
+		return "JOB"
+	}
+	return ""
+}
+
+// GetTasks returns the tasks of a (sub)graph in topological order. The context of each task
+// is retrieved from 'cfg'. Sources and artifacts are the 'data' fields of the predecessors
+// and successors of the task, respectively.
+//
+// Commands, values of environment variables and data patterns are rendered as Go templates
+// (text/template). See Config.context for the data available in the templates. Additionally,
+// 'sources' and 'artifacts' are available in the templates of the tasks; the lists of data
+// patterns of the predecessors and the successors, which are rendered space-separated.
+func GetTasks(d *dep.DependencyGraph, cfg *Config) ([]*Task, error) {
+	s, err := d.Sort()
+	if err != nil {
+		return nil, cycleError(d, err)
+	}
+	o := make([]*Task, 0)
+	for _, n := range s {
+		x := n.(*dot.Node)
+		if !isJob(x) {
 			continue
 		}
-		if a, e := x.Attribute("type"); e == nil && strings.ToLower(a) == "job" {
-			o = append(o, x.DOTID())
+		t := &Task{
+			ID:        x.ID(),
+			DOTID:     x.DOTID(),
+			Env:       make(map[string]string),
+			Sources:   make(map[string]string),
+			Artifacts: make(map[string]string),
+			Results:   make(map[string]string),
+		}
+		ctx := cfg.context(x)
+		for _, v := range []struct {
+			ns  graph.Nodes
+			m   map[string]string
+			key string
+		}{
+			{d.To(x.ID()), t.Sources, "sources"},
+			{d.From(x.ID()), t.Artifacts, "artifacts"},
+		} {
+			ps := make([]string, 0)
+			for _, p := range graph.NodesOf(v.ns) {
+				y := p.(*dot.Node)
+				fs, err := cfg.data(y)
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range fs {
+					v.m[f] = y.DOTID()
+				}
+				ps = append(ps, fs...)
+			}
+			sort.Strings(ps)
+			ctx[v.key] = list(ps)
 		}
+		if j, ok := cfg.Jobs.Get(nodeType(x), x.DOTID()); ok {
+			name := nodeType(x) + "|" + x.DOTID()
+			t.Description = j.Description
+			t.AllowFailure = j.AllowFailure
+			if j.Timeout != "" {
+				if t.Timeout, err = time.ParseDuration(j.Timeout); err != nil {
+					return nil, fmt.Errorf("timeout of task '%s': %w", x.DOTID(), err)
+				}
+			}
+			t.Retries, t.RetryOn = j.Retries, j.RetryOn
+			if j.RetryDelay != "" {
+				if t.RetryDelay, err = time.ParseDuration(j.RetryDelay); err != nil {
+					return nil, fmt.Errorf("retry_delay of task '%s': %w", x.DOTID(), err)
+				}
+			}
+			for k, v := range j.Env {
+				e, err := expand(name, v, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("env of task '%s': %w", x.DOTID(), err)
+				}
+				t.Env[k] = e
+			}
+			if len(j.Cmds) != 0 {
+				c, err := expandAll(name, j.Cmds, ctx)
+				if err != nil {
+					return nil, fmt.Errorf("cmds of task '%s': %w", x.DOTID(), err)
+				}
+				t.Cmds = [][]string{shellCmd(c)}
+			}
+		}
+		o = append(o, t)
+	}
+	return o, nil
+}
+
+// Script returns the commands of the task as the lines of a shell script.
+func (t *Task) Script() []string {
+	o := make([]string, 0)
+	for _, c := range t.Cmds {
+		if s := shellScript(c); s != nil {
+			o = append(o, s...)
+			continue
+		}
+		o = append(o, strings.Join(c, " "))
 	}
 	return o
 }
 
+// Exec executes the commands of the task sequentially, in directory 'dir'. It stops at the
+// first command that fails. If not nil, the output is captured in 'cmdOut' and 'cmdErr', and
+// it is written to 'w' line by line. Commands are signalled when the context is done or the
+// timeout of the task is exceeded, and they are killed after 'grace' (see ExecCmdContext).
+func (t *Task) Exec(ctx context.Context, grace time.Duration, dir string, cmdOut, cmdErr *bytes.Buffer, w io.Writer) error {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	env := make([]string, 0, len(t.Env))
+	for k, v := range t.Env {
+		env = append(env, k+"="+v)
+	}
+	for _, c := range t.Cmds {
+		if len(c) == 0 {
+			continue
+		}
+		if err := ExecCmdContext(ctx, grace, dir, c[0], c[1:], env, cmdOut, cmdErr, w); err != nil {
+			return fmt.Errorf("task %s: %w", t.DOTID, err)
+		}
+	}
+	return nil
+}
+
 /*
 	err := ioutil.WriteGraphToFile("testdata/hello", message, 0644)
 	if err != nil {
@@ -85,35 +280,106 @@ func GetTaskList(d *dep.DependencyGraph) []string {
 		//t := lib.GetTaskListAll(s)
 */
 
-func List(f string, args []string) {
-	l, r := InduceSubGraphsFromFile(f)
-	if len(l) == 0 || len(r) == 0 {
-		log.Fatal("Something went wrong. Empty subgraph map!")
+// TaskList is the ordered list of tasks of the subgraph for a node.
+type TaskList struct {
+	Name  string
+	Tasks []string
+	// Stages are the tasks grouped in stages which can be executed at the same time (see
+	// Stages). They are only set by ListStages.
+	Stages [][]string
+}
+
+// List returns the list of tasks of the subgraph for each of the given nodes. If no node is
+// given, the lists for all the leafs are returned.
+func List(l, r map[string]*dep.DependencyGraph, args []string) ([]TaskList, error) {
+	o := make([]TaskList, 0)
+	err := eachSubGraph(l, r, args, func(n string, s *dep.DependencyGraph) error {
+		ts, err := GetTaskList(s)
+		if err != nil {
+			return err
+		}
+		o = append(o, TaskList{Name: n, Tasks: ts})
+		return nil
+	})
+	return o, err
+}
+
+// ListStages is the same as List, but the tasks are also grouped in stages of at most
+// 'width' tasks (see Stages).
+func ListStages(l, r map[string]*dep.DependencyGraph, args []string, width int) ([]TaskList, error) {
+	o := make([]TaskList, 0)
+	err := eachSubGraph(l, r, args, func(n string, s *dep.DependencyGraph) error {
+		ts, err := GetTaskList(s)
+		if err != nil {
+			return err
+		}
+		ss, err := Stages(s, width)
+		if err != nil {
+			return err
+		}
+		o = append(o, TaskList{Name: n, Tasks: ts, Stages: ss})
+		return nil
+	})
+	return o, err
+}
+
+// Stages returns the DOTIDs of the tasks of a (sub)graph grouped in stages, where all the
+// tasks in a stage can be executed at the same time, and each stage has at most 'width'
+// tasks (unlimited if zero). Non-job nodes are removed before computing the stages (see
+// dep.Schedule), so a task depends on another one if there is a path between them. A
+// CycleError is returned if the graph is not acyclic.
+func Stages(d *dep.DependencyGraph, width int) ([][]string, error) {
+	if _, err := d.Sort(); err != nil {
+		return nil, cycleError(d, err)
+	}
+	j := dep.NewDependencyGraph(nil)
+	ns := make([]graph.Node, 0)
+	for _, n := range graph.NodesOf(d.Nodes()) {
+		if isJob(n.(*dot.Node)) {
+			j.AddNode(n)
+			ns = append(ns, n)
+		}
 	}
+	for _, u := range ns {
+		for _, v := range ns {
+			if u.ID() != v.ID() && d.Reaches(u.ID(), v.ID()) {
+				j.SetEdge(simple.Edge{F: u, T: v})
+			}
+		}
+	}
+	o := make([][]string, 0)
+	for _, s := range j.Schedule(width) {
+		x := make([]string, 0, len(s))
+		for _, n := range s {
+			x = append(x, n.(*dot.Node).DOTID())
+		}
+		o = append(o, x)
+	}
+	return o, nil
+}
+
+// eachSubGraph calls 'f' with the subgraph for each of the given selection expressions, along
+// with its name (see Select). If none is given, 'f' is called for each of the leafs, sorted by
+// name. It stops at the first error.
+func eachSubGraph(l, r map[string]*dep.DependencyGraph, args []string, f func(string, *dep.DependencyGraph) error) error {
 	if len(args) != 0 {
 		for _, a := range args {
-			s, n := GetSubGraph(l, r, a)
-			if s == nil {
-				log.Fatal("Something went wrong. Empty subgraph!")
+			s, n, err := Select(l, r, a)
+			if err != nil {
+				return err
 			}
-			fmt.Printf("[%s]\n", n)
-			for _, i := range GetTaskList(s) {
-				fmt.Println("  ", i)
+			if err := f(n, s); err != nil {
+				return err
 			}
 		}
-		return
+		return nil
 	}
-	for a, d := range l {
-		fmt.Printf("[%s]\n", a)
-		for _, i := range GetTaskList(d) {
-			fmt.Println("  ", i)
+	for _, a := range sortedGraphKeys(l) {
+		if err := f(a, l[a]); err != nil {
+			return err
 		}
-		/* Print list
-		if e := WriteGraphToFile(path.Join(o, a+".dot"), d); e != nil {
-			log.Fatal(e)
-		}
-		*/
 	}
+	return nil
 }
 
 /*
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/dbhi/run/dot"
+)
+
+// funcs are the functions available in the templates, in addition to the builtin ones.
+var funcs = template.FuncMap{
+	"join": strings.Join,
+}
+
+// list is a list of values in the data of the templates, which is rendered space-separated
+// (e.g. '{{.sources}}'), so that it can be used as the arguments of a command as is. It can
+// be used as a []string too (e.g. '{{join .sources ","}}' or '{{range .sources}}').
+type list []string
+
+func (l list) String() string { return strings.Join(l, " ") }
+
+// expand renders text 's' as a Go template (text/template). Unknown keys produce an error.
+func expand(name, s string, ctx map[string]interface{}) (string, error) {
+	t, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, ctx); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// expandAll renders each of the texts in 'ss'.
+func expandAll(name string, ss []string, ctx map[string]interface{}) ([]string, error) {
+	o := make([]string, 0, len(ss))
+	for _, s := range ss {
+		x, err := expand(name, s, ctx)
+		if err != nil {
+			return nil, err
+		}
+		o = append(o, x)
+	}
+	return o, nil
+}
+
+// environ returns the environment variables of the process as a map.
+func environ() map[string]string {
+	o := make(map[string]string)
+	for _, e := range os.Environ() {
+		if i := strings.Index(e, "="); i > 0 {
+			o[e[:i]] = e[i+1:]
+		}
+	}
+	return o
+}
+
+// context returns the data available in the templates of node 'n':
+//   - id: the DOTID of the node.
+//   - attrs: the DOT attributes of the node.
+//   - vars: the variables of the configuration, overridden by those of the job.
+//   - env: the environment variables.
+func (c *Config) context(n *dot.Node) map[string]interface{} {
+	attrs := make(map[string]string)
+	for _, a := range n.Attributes() {
+		attrs[a.Key] = a.Value
+	}
+	vars := make(map[string]string)
+	for k, v := range c.Vars {
+		vars[k] = v
+	}
+	if j, ok := c.Jobs.Get(nodeType(n), n.DOTID()); ok {
+		for k, v := range j.Vars {
+			vars[k] = v
+		}
+	}
+	return map[string]interface{}{
+		"id":    n.DOTID(),
+		"attrs": attrs,
+		"vars":  vars,
+		"env":   environ(),
+	}
+}
+
+// data returns the 'data' patterns of node 'n', rendered as templates.
+func (c *Config) data(n *dot.Node) ([]string, error) {
+	k := nodeType(n) + "|" + n.DOTID()
+	j, ok := c.Jobs.Get(nodeType(n), n.DOTID())
+	if !ok {
+		return nil, nil
+	}
+	o, err := expandAll(k, j.Data, c.context(n))
+	if err != nil {
+		return nil, fmt.Errorf("data of node '%s': %w", n.DOTID(), err)
+	}
+	return o, nil
+}
@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetTasksTemplates(t *testing.T) {
+	d := newTestGraph(t, `strict digraph {
+srcA   [type="SRC"];
+buildA [type="JOB" tool="gcc"];
+objA   [type="OBJ"];
+srcA -> buildA -> objA;
+}`)
+	t.Setenv("RUN_TEST_FLAGS", "-O2")
+	cfg := &Config{
+		Vars: map[string]string{"out": "build", "cc": "cc"},
+		Jobs: Jobs{
+			"SRC|srcA": Job{Data: []string{"{{.id}}/*.c", "{{.id}}/*.h"}},
+			"JOB|buildA": Job{
+				Vars: map[string]string{"cc": "clang"},
+				Env:  map[string]string{"CFLAGS": "{{.env.RUN_TEST_FLAGS}}"},
+				Cmds: []string{"{{.attrs.tool}} {{.sources}} -o {{join .artifacts \" \"}} # {{.id}} {{.vars.cc}}"},
+			},
+			"OBJ|objA": Job{Data: []string{"{{.vars.out}}/a.o"}},
+		},
+	}
+	ts, err := GetTasks(d, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := ts[0]
+	if s := shellScript(task.Cmds[0]); len(s) != 1 || s[0] != "gcc srcA/*.c srcA/*.h -o build/a.o # buildA clang" {
+		t.Errorf("unexpected command %q", s)
+	}
+	if task.Env["CFLAGS"] != "-O2" {
+		t.Errorf("unexpected env %q", task.Env["CFLAGS"])
+	}
+	if task.Sources["srcA/*.c"] != "srcA" || task.Artifacts["build/a.o"] != "objA" {
+		t.Errorf("unexpected sources %v or artifacts %v", task.Sources, task.Artifacts)
+	}
+
+	cfg.Jobs["JOB|buildA"] = Job{Cmds: []string{"echo {{.vars.unknown}}"}}
+	if _, err := GetTasks(d, cfg); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("expected an error about the unknown key, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// file is a path matched by a data pattern, along with its modification time.
+type file struct {
+	path  string
+	mtime time.Time
+}
+
+// glob returns the files matched by pattern 'p'. Relative patterns are evaluated in 'dir'.
+func glob(dir, p string) ([]file, error) {
+	p = resolve(dir, p)
+	m, err := filepath.Glob(p)
+	if err != nil {
+		return nil, fmt.Errorf("pattern '%s': %w", p, err)
+	}
+	o := make([]file, 0, len(m))
+	for _, x := range m {
+		i, err := os.Stat(x)
+		if err != nil {
+			continue
+		}
+		o = append(o, file{x, i.ModTime()})
+	}
+	return o, nil
+}
+
+// sortedKeys returns the keys of a map in lexical order.
+func sortedKeys(m map[string]string) []string {
+	o := make([]string, 0, len(m))
+	for k := range m {
+		o = append(o, k)
+	}
+	sort.Strings(o)
+	return o
+}
+
+// UpToDate compares the modification times of the files matched by the sources and the
+// artifacts of the task, in the same way as Make. The task is up to date if all of the
+// artifacts exist and are newer than every source. A reason is returned along with the
+// result, to explain why the task needs to be executed or not.
+func (t *Task) UpToDate(dir string) (bool, string, error) {
+	if len(t.Artifacts) == 0 {
+		return false, "no artifacts defined", nil
+	}
+
+	var oldest *file
+	for _, p := range sortedKeys(t.Artifacts) {
+		fs, err := glob(dir, p)
+		if err != nil {
+			return false, "", err
+		}
+		if len(fs) == 0 {
+			return false, fmt.Sprintf("artifact '%s' of '%s' not found", p, t.Artifacts[p]), nil
+		}
+		for i := range fs {
+			if oldest == nil || fs[i].mtime.Before(oldest.mtime) {
+				oldest = &fs[i]
+			}
+		}
+	}
+
+	var newest *file
+	for _, p := range sortedKeys(t.Sources) {
+		fs, err := glob(dir, p)
+		if err != nil {
+			return false, "", err
+		}
+		for i := range fs {
+			if newest == nil || fs[i].mtime.After(newest.mtime) {
+				newest = &fs[i]
+			}
+		}
+	}
+
+	if newest == nil {
+		return true, "artifacts exist and no sources were found", nil
+	}
+	if !newest.mtime.Before(oldest.mtime) {
+		return false, fmt.Sprintf("source '%s' is newer than artifact '%s'", newest.path, oldest.path), nil
+	}
+	return true, fmt.Sprintf("artifact '%s' is newer than source '%s'", oldest.path, newest.path), nil
+}
@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTaskUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	touch := func(n string, m time.Time) {
+		p := filepath.Join(dir, n)
+		if err := os.WriteFile(p, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, m, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	touch("a.c", now.Add(-2*time.Hour))
+	touch("b.c", now.Add(-1*time.Hour))
+	touch("a.o", now)
+
+	task := &Task{
+		DOTID:     "buildA",
+		Sources:   map[string]string{"*.c": "srcA"},
+		Artifacts: map[string]string{"a.o": "objA"},
+	}
+	for _, x := range []struct {
+		name string
+		prep func()
+		ok   bool
+	}{
+		{"newer artifact", func() {}, true},
+		{"newer source", func() { touch("b.c", now.Add(time.Hour)) }, false},
+		{"missing artifact", func() { task.Artifacts["b.o"] = "objB" }, false},
+	} {
+		x.prep()
+		ok, why, err := task.UpToDate(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != x.ok {
+			t.Errorf("%s: expected %t, got %t (%s)", x.name, x.ok, ok, why)
+		}
+	}
+}
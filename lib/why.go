@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dbhi/run/dep"
+	"github.com/dbhi/run/dot"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/encoding"
+)
+
+// Path is a sequence of nodes, where each node depends on the previous one.
+type Path struct {
+	// Nodes are the DOTIDs of the nodes in the path.
+	Nodes []string
+	// Attrs are the DOT attributes of the edge between each pair of consecutive nodes.
+	Attrs []map[string]string
+}
+
+// String returns the path as 'getA -> srcA -(label=x)-> buildA', where the attributes of the
+// edges are shown between parenthesis.
+func (p Path) String() string {
+	var b strings.Builder
+	for i, n := range p.Nodes {
+		if i != 0 {
+			b.WriteString(" -")
+			if a := p.Attrs[i-1]; len(a) != 0 {
+				kv := make([]string, 0, len(a))
+				for _, k := range sortedKeys(a) {
+					kv = append(kv, k+"="+a[k])
+				}
+				b.WriteString("(" + strings.Join(kv, ",") + ")-")
+			}
+			b.WriteString("> ")
+		}
+		b.WriteString(n)
+	}
+	return b.String()
+}
+
+// newPath returns the Path for a sequence of nodes of graph 'd'.
+func newPath(d *dep.DependencyGraph, ns []graph.Node) Path {
+	p := Path{Nodes: make([]string, 0, len(ns)), Attrs: make([]map[string]string, 0, len(ns))}
+	for i, n := range ns {
+		p.Nodes = append(p.Nodes, n.(*dot.Node).DOTID())
+		if i == 0 {
+			continue
+		}
+		a := make(map[string]string)
+		if e, ok := d.Edge(ns[i-1].ID(), n.ID()).(encoding.Attributer); ok {
+			for _, x := range e.Attributes() {
+				a[x.Key] = x.Value
+			}
+		}
+		p.Attrs = append(p.Attrs, a)
+	}
+	return p
+}
+
+// node returns the node of 'd' with the given DOTID (see dot.Qualify), or a NodeNotFoundError.
+func node(d *dep.DependencyGraph, id string) (graph.Node, error) {
+	n := d.NodeByDOTID(dot.Qualify("", id))
+	if n == nil {
+		return nil, &NodeNotFoundError{DOTID: id}
+	}
+	return n, nil
+}
+
+// Why returns the paths from node 'from' to node 'to', sorted by length (see dep.Paths). If
+// 'k' is greater than zero, only the 'k' shortest paths are returned. If 'to' does not depend
+// on 'from', the result is empty; paths in the opposite direction are not searched.
+func Why(d *dep.DependencyGraph, from, to string, k int) ([]Path, error) {
+	u, err := node(d, from)
+	if err != nil {
+		return nil, err
+	}
+	v, err := node(d, to)
+	if err != nil {
+		return nil, err
+	}
+	ps := d.Paths(u.ID(), v.ID(), k)
+	o := make([]Path, 0, len(ps))
+	for _, p := range ps {
+		o = append(o, newPath(d, p))
+	}
+	return o, nil
+}
+
+// WhyReverse returns the leafs which depend on node 'id' (see dep.LeafsOf), along with the
+// shortest path from the node to each of them (see dep.ShortestPaths). Paths are sorted by the
+// DOTID of the leaf.
+func WhyReverse(d *dep.DependencyGraph, id string) ([]Path, error) {
+	u, err := node(d, id)
+	if err != nil {
+		return nil, err
+	}
+	ls := make([]int64, 0)
+	for l := range d.LeafsOf(u.ID()) {
+		ls = append(ls, l)
+	}
+	o := make([]Path, 0, len(ls))
+	for _, p := range d.ShortestPaths(u.ID(), ls) {
+		o = append(o, newPath(d, p))
+	}
+	sort.Slice(o, func(i, j int) bool { return o[i].Nodes[len(o[i].Nodes)-1] < o[j].Nodes[len(o[j].Nodes)-1] })
+	return o, nil
+}
@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	d, err := ParseGraph([]byte(`digraph {
+getA -> srcA [label="fetch"];
+srcA -> buildA -> objA -> build -> bin;
+objA -> buildB -> objB -> build;
+srcDoc -> buildDoc -> doc;
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []struct {
+		from, to string
+		k        int
+		e        []string
+	}{
+		{"getA", "bin", 0, []string{
+			"getA -(label=fetch)-> srcA -> buildA -> objA -> build -> bin",
+			"getA -(label=fetch)-> srcA -> buildA -> objA -> buildB -> objB -> build -> bin",
+		}},
+		{"getA", "bin", 1, []string{
+			"getA -(label=fetch)-> srcA -> buildA -> objA -> build -> bin",
+		}},
+		{"bin", "getA", 0, []string{}},
+		{"doc", "bin", 0, []string{}},
+	} {
+		ps, err := Why(d, x.from, x.to, x.k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ps) != len(x.e) {
+			t.Errorf("Why(%s, %s, %d): expected %v, got %v", x.from, x.to, x.k, x.e, ps)
+			continue
+		}
+		for i, p := range ps {
+			if p.String() != x.e[i] {
+				t.Errorf("Why(%s, %s, %d): expected %s, got %s", x.from, x.to, x.k, x.e[i], p)
+			}
+		}
+	}
+
+	if _, err := Why(d, "getA", "none", 0); !errors.Is(err, ErrNodeNotFound) {
+		t.Errorf("expected ErrNodeNotFound, got %v", err)
+	}
+
+	ps, err := WhyReverse(d, "srcDoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].String() != "srcDoc -> buildDoc -> doc" {
+		t.Errorf("WhyReverse(srcDoc): unexpected %v", ps)
+	}
+
+	ps, err = WhyReverse(d, "srcA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].String() != "srcA -> buildA -> objA -> build -> bin" {
+		t.Errorf("WhyReverse(srcA): unexpected %v", ps)
+	}
+}